@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// newAccessKeysCmd manages access keys of service accounts, which are credential secrets labelled by access key id
+func newAccessKeysCmd() *cobra.Command {
+	var namespace, serviceAccount string
+
+	cmd := &cobra.Command{
+		Use:   "access-keys",
+		Short: "Manage access keys of service accounts.",
+	}
+	cmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "Namespace of the service account.")
+	cmd.PersistentFlags().StringVarP(&serviceAccount, "service-account", "s", "", "Service account the access key acts as.")
+	if err := cmd.MarkPersistentFlagRequired("service-account"); err != nil {
+		klog.Fatal(err)
+	}
+
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Mint a new access key of service account.",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			kc := sharedcfg.New(ctx, namespace).Configs().KubeClient()
+			cred, err := controllers.CreateCredential(ctx, kc, namespace, serviceAccount)
+			if err != nil {
+				klog.Fatalf("create access key of %s/%s error %v", namespace, serviceAccount, err)
+			}
+			printCredential(cred)
+		},
+	}
+
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Mint a new access key of service account and delete the others.",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := context.Background()
+			kc := sharedcfg.New(ctx, namespace).Configs().KubeClient()
+			cred, err := controllers.CreateCredential(ctx, kc, namespace, serviceAccount)
+			if err != nil {
+				klog.Fatalf("create access key of %s/%s error %v", namespace, serviceAccount, err)
+			}
+			deleted, err := controllers.DeleteCredentials(ctx, kc, namespace, serviceAccount, cred.AccessKeyID)
+			for _, id := range deleted {
+				klog.Infof("deleted access key %s of %s/%s", id, namespace, serviceAccount)
+			}
+			if err != nil {
+				klog.Errorf("delete old access keys of %s/%s error %v, new key is created", namespace, serviceAccount, err)
+			}
+			printCredential(cred)
+		},
+	}
+
+	cmd.AddCommand(create, rotate)
+	return cmd
+}
+
+func printCredential(cred *controllers.Credential) {
+	fmt.Printf("AccessKeyId: %s\nSecretAccessKey: %s\nRegion: %s\n", cred.AccessKeyID, cred.SecretAccessKey, cred.Namespace)
+}
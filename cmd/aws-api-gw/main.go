@@ -11,7 +11,9 @@ import (
 	"github.com/Arvintian/go-utils/cmdutil/flagtools"
 	"github.com/Arvintian/go-utils/cmdutil/pflagenv"
 	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
 	"github.com/refunc/aws-api-gw/pkg/routers"
+	"github.com/refunc/aws-api-gw/pkg/services"
 	"github.com/refunc/aws-api-gw/pkg/version"
 	"github.com/spf13/cobra"
 	"k8s.io/klog/v2"
@@ -22,6 +24,7 @@ import (
 
 var config struct {
 	routerCfg routers.Config
+	codeGCCfg services.CodeGCConfig
 	Debug     bool
 	Addr      string
 	Namespace string
@@ -51,11 +54,29 @@ func main() {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
+			for ns, id := range config.routerCfg.AccountIDs {
+				if !controllers.ValidAccountID(id) {
+					klog.Fatalf("invalid account id %q of namespace %s", id, ns)
+				}
+			}
+
+			if config.routerCfg.Authorization && !config.routerCfg.Rbac {
+				klog.Fatal("--rbac-authz requires --rbac")
+			}
+			if config.routerCfg.IAMPolicies && !config.routerCfg.Rbac {
+				klog.Fatal("--iam-policies requires --rbac")
+			}
+
 			sc := sharedcfg.New(ctx, config.Namespace)
 
 			// create router and init informers
 			router := routers.CreateHTTPRouter(sc.Configs(), config.routerCfg, ctx.Done())
 
+			// collect orphaned function code
+			sc.AddController(func(cfg sharedcfg.Configs) sharedcfg.Runner {
+				return services.NewCodeCollector(cfg, config.codeGCCfg)
+			})
+
 			go func() {
 				klog.Infof("Refunc aws lambda api gateway version: %s\n", version.Version)
 				klog.Infof("Listening and serving HTTP on %s\n", config.Addr)
@@ -82,8 +103,21 @@ func main() {
 
 	cmd.Flags().StringVar(&config.Addr, "addr", "0.0.0.0:9000", "ListenAndServe Address.")
 	cmd.Flags().BoolVar(&config.routerCfg.Rbac, "rbac", false, "Enable rbac auth.")
+	cmd.Flags().BoolVar(&config.routerCfg.Authorization, "rbac-authz", false, "Authorize requests by SubjectAccessReview of the authenticated service account, requires --rbac.")
+	cmd.Flags().BoolVar(&config.routerCfg.IAMPolicies, "iam-policies", false, "Evaluate iam identity policies from service account annotation lambda.refunc.io/policy and labelled config maps, requires --rbac.")
+	cmd.Flags().BoolVar(&config.routerCfg.CopyS3Code, "copy-s3-code", false, "Copy S3Bucket/S3Key code into managed bucket instead of referencing it.")
+	cmd.Flags().StringVar(&services.PublicEndpoint, "s3-public-endpoint", "", "Minio endpoint reachable by clients, e.g. https://s3.example.com, code download and upload urls are presigned for it instead of the in-cluster endpoint.")
+	cmd.Flags().DurationVar(&config.codeGCCfg.Interval, "code-gc-interval", 10*time.Minute, "Interval to collect orphaned function code, 0 to disable.")
+	cmd.Flags().DurationVar(&config.codeGCCfg.GracePeriod, "code-gc-grace", time.Hour, "Orphaned function code modified within grace period is kept.")
+	cmd.Flags().BoolVar(&config.codeGCCfg.DryRun, "code-gc-dry-run", false, "Only report orphaned function code without removing it.")
+	cmd.Flags().StringToStringVar(&config.routerCfg.RegionNamespaces, "region-namespaces", nil, "Map aws regions to namespaces, e.g. us-east-1=ns1,eu-west-1=ns2, other regions are used as namespaces.")
+	cmd.Flags().StringToStringVar(&config.routerCfg.AccountIDs, "account-ids", nil, "Map namespaces to 12 digit aws account ids, e.g. ns1=123456789012,ns2=210987654321.")
+	cmd.Flags().BoolVar(&config.routerCfg.AccountIDFromNamespace, "account-id-from-namespace", false, "Read aws account id from namespace annotation lambda.refunc.io/account-id, requires permission to list namespaces.")
+	cmd.Flags().BoolVar(&config.routerCfg.TrustFromNamespace, "trust-from-namespace", false, "Let access keys act in namespaces whose annotation lambda.refunc.io/trusted-namespaces lists their namespace, requires permission to list namespaces.")
+	cmd.Flags().StringVar(&config.routerCfg.SessionTokenKey, "session-token-key", "", "Key to sign session tokens of sts temporary credentials, share it among replicas.")
 	cmd.Flags().BoolVar(&config.Debug, "debug", false, "Enable gin's debug mode.")
 	cmd.Flags().StringVarP(&config.Namespace, "namespace", "n", "", "The scope of namepsace to manipulate.")
+	cmd.AddCommand(newAccessKeysCmd())
 	flagtools.BindFlags(cmd.PersistentFlags())
 
 	// set global flags using env
@@ -1,5 +1,6 @@
 package apis
 
 type FunctionConcurrencyConfig struct {
-	ReservedConcurrentExecutions int64 `json:"ReservedConcurrentExecutions"`
+	ReservedConcurrentExecutions int64  `json:"ReservedConcurrentExecutions"`
+	RevisionId                   string `json:"RevisionId,omitempty"`
 }
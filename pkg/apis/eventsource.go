@@ -1,8 +1,10 @@
 package apis
 
 type EventSourceMappingConfiguration struct {
-	EventSourceArn         string                 `json:"EventSourceArn"` //arn:<trigger-type>:<trigger-name>
-	FunctionArn            string                 `json:"FunctionName"`
+	EventSourceArn         string                 `json:"EventSourceArn"` //arn:aws:refunc:<region>:<account>:<trigger-type>/<trigger-name>, or arn:<trigger-type>:<trigger-name>
+	EventSourceMappingArn  string                 `json:"EventSourceMappingArn,omitempty"`
+	FunctionArn            string                 `json:"FunctionArn,omitempty"`
+	FunctionName           string                 `json:"FunctionName,omitempty"`
 	SelfManagedEventSource SelfManagedEventSource `json:"SelfManagedEventSource"`
 	UUID                   string                 `json:"UUID"`
 }
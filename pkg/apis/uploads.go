@@ -0,0 +1,10 @@
+package apis
+
+// CodeUploadConfig is a presigned PUT url for staging a code package, gateway extension
+type CodeUploadConfig struct {
+	UploadUrl  string `json:"UploadUrl"`
+	Method     string `json:"Method"`
+	S3Bucket   string `json:"S3Bucket"`
+	S3Key      string `json:"S3Key"`
+	Expiration string `json:"Expiration"`
+}
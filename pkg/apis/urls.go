@@ -12,6 +12,7 @@ type FunctionURLConfig struct {
 	FunctionArn      string  `json:"FunctionArn"`
 	FunctionUrl      string  `json:"FunctionUrl"`
 	LastModifiedTime string  `json:"LastModifiedTime"`
+	RevisionId       string  `json:"RevisionId,omitempty"`
 }
 
 type URLCors struct {
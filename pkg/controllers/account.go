@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+
+	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LambdaAnnotationAccountID on a namespace pins the aws account id of it
+const LambdaAnnotationAccountID = "lambda.refunc.io/account-id"
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// AccountIDs maps namespaces to aws account ids, in order of configured mapping,
+// namespace annotation and an id derived from namespace name.
+type AccountIDs struct {
+	static          map[string]string
+	namespaceLister corelisters.NamespaceLister
+	HasSynced       cache.InformerSynced
+}
+
+// ValidAccountID reports if id is a 12 digit account id
+func ValidAccountID(id string) bool {
+	return accountIDPattern.MatchString(id)
+}
+
+// NewAccountIDs creates the mapping, namespace annotations are looked up only if fromNamespace,
+// which requires permission to list namespaces.
+func NewAccountIDs(sc sharedcfg.Configs, static map[string]string, fromNamespace bool) *AccountIDs {
+	accounts := &AccountIDs{
+		static:    static,
+		HasSynced: func() bool { return true },
+	}
+	if fromNamespace {
+		informer := sc.KubeInformers().Core().V1().Namespaces()
+		accounts.namespaceLister = informer.Lister()
+		accounts.HasSynced = informer.Informer().HasSynced
+	}
+	return accounts
+}
+
+// AccountID returns the 12 digit account id of namespace
+func (a *AccountIDs) AccountID(ns string) string {
+	if id, ok := a.static[ns]; ok {
+		return id
+	}
+	if a.namespaceLister != nil {
+		if namespace, err := a.namespaceLister.Get(ns); err == nil {
+			if id := namespace.Annotations[LambdaAnnotationAccountID]; accountIDPattern.MatchString(id) {
+				return id
+			}
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(ns))
+	return fmt.Sprintf("%012d", h.Sum64()%1000000000000)
+}
@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/refunc/aws-api-gw/pkg/apis"
+	"github.com/refunc/aws-api-gw/pkg/services"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -25,33 +29,83 @@ const (
 	HeaderAmzExecutedVersion = "X-Amz-Executed-Version"
 )
 
-func FuncdefToLambdaConfiguration(fndef rfv1beta3.Funcdef) (apis.FunctionConfiguration, error) {
+// published versions are funcdefs named by VersionFuncdefName and labeled with the function they belong to
+const (
+	LambdaLabelVersionOf          = "lambda.refunc.io/version-of"
+	LambdaAnnotationLatestVersion = "lambda.refunc.io/latest-version"
+)
+
+func FuncdefToLambdaConfiguration(fndef rfv1beta3.Funcdef, region, account string) (apis.FunctionConfiguration, error) {
 	custom := map[string]interface{}{}
 	err := json.Unmarshal(fndef.Spec.Custom, &custom)
 	var codeSize int64
+	codeSha256 := fndef.Spec.Hash
 	if err == nil {
 		size, ok := custom["codeSize"].(float64)
 		if ok {
 			codeSize = int64(size)
 		}
+		if sha, ok := custom["codeSha256"].(string); ok && sha != "" {
+			codeSha256 = sha
+		}
+	}
+	functionName, version := fndef.Name, LambdaVersion
+	functionArn := awsutils.FunctionArn(region, account, functionName, "")
+	if name, ok := fndef.Labels[LambdaLabelVersionOf]; ok {
+		functionName, version = name, fndef.Labels[rfv1beta3.LabelLambdaVersion]
+		functionArn = awsutils.FunctionArn(region, account, functionName, version)
 	}
 	return apis.FunctionConfiguration{
-		CodeSha256: fndef.Spec.Hash,
+		CodeSha256: codeSha256,
 		CodeSize:   codeSize,
 		Environment: &apis.FunctionEnvironment{
 			Variables: fndef.Spec.Runtime.Envs,
 		},
-		FunctionName: fndef.Name,
+		FunctionArn:  functionArn,
+		FunctionName: functionName,
 		Handler:      fndef.Spec.Entry,
 		LastModified: fndef.CreationTimestamp.Format(time.RFC3339),
-		Version:      LambdaVersion,
+		Version:      version,
 		RevisionId:   fndef.ResourceVersion,
 		Runtime:      fndef.Spec.Runtime.Name,
 		Timeout:      int64(fndef.Spec.Runtime.Timeout),
 	}, nil
 }
 
-func HTTPtriggerToURLConfig(trigger rfv1beta3.Trigger) (apis.FunctionURLConfig, error) {
+// SetFuncdefCode sets code body and hash of funcdef, code size and aws CodeSha256 are kept in custom
+func SetFuncdefCode(fndef *rfv1beta3.Funcdef, code services.FunctionCode) error {
+	custom := map[string]interface{}{}
+	if len(fndef.Spec.Custom) > 0 {
+		if err := json.Unmarshal(fndef.Spec.Custom, &custom); err != nil {
+			return err
+		}
+	}
+	custom["codeSize"] = code.Size
+	custom["codeSha256"] = code.CodeSha256
+	bts, err := json.Marshal(custom)
+	if err != nil {
+		return err
+	}
+	if code.Body != "" {
+		fndef.Spec.Body = code.Body
+	}
+	fndef.Spec.Hash = code.Hash
+	fndef.Spec.Custom = bts
+	return nil
+}
+
+// VersionFuncdefName returns name of the funcdef which holds a published lambda version, suffixed by a hash
+// of function and version so it never takes the name of another function, and truncated to fit 63 characters
+func VersionFuncdefName(name, version string) string {
+	sum := sha256.Sum256([]byte(name + ":" + version))
+	suffix := fmt.Sprintf("-v%s-%x", version, sum[:4])
+	if max := validation.DNS1123LabelMaxLength - len(suffix); len(name) > max {
+		name = strings.TrimRight(name[:max], "-_.")
+	}
+	return name + suffix
+}
+
+func HTTPtriggerToURLConfig(trigger rfv1beta3.Trigger, region, account string) (apis.FunctionURLConfig, error) {
 	if trigger.Spec.Type != "httptrigger" {
 		return apis.FunctionURLConfig{}, fmt.Errorf("trigger %s not is http type", trigger.Name)
 	}
@@ -62,14 +116,15 @@ func HTTPtriggerToURLConfig(trigger rfv1beta3.Trigger) (apis.FunctionURLConfig,
 	return apis.FunctionURLConfig{
 		AuthType:         httpCfg.AuthType,
 		Cors:             apis.URLCors(httpCfg.Cors),
-		FunctionArn:      trigger.Spec.FuncName,
+		FunctionArn:      awsutils.FunctionArn(region, account, trigger.Spec.FuncName, ""),
 		FunctionUrl:      fmt.Sprintf("/%s/%s", trigger.Namespace, trigger.Spec.FuncName),
 		CreationTime:     trigger.CreationTimestamp.Format(time.RFC3339),
 		LastModifiedTime: trigger.CreationTimestamp.Format(time.RFC3339),
+		RevisionId:       trigger.ResourceVersion,
 	}, nil
 }
 
-func TriggerToEventSourceConfig(trigger rfv1beta3.Trigger) (apis.EventSourceMappingConfiguration, error) {
+func TriggerToEventSourceConfig(trigger rfv1beta3.Trigger, region, account string) (apis.EventSourceMappingConfiguration, error) {
 	if trigger.Spec.Type == HTTPTriggerType {
 		return apis.EventSourceMappingConfiguration{}, fmt.Errorf("trigger %s is http type", trigger.Name)
 	}
@@ -100,8 +155,9 @@ func TriggerToEventSourceConfig(trigger rfv1beta3.Trigger) (apis.EventSourceMapp
 		}
 	}
 	return apis.EventSourceMappingConfiguration{
-		EventSourceArn: fmt.Sprintf("arn:%s:%s", trigger.Spec.Type, strings.TrimPrefix(trigger.Name, fmt.Sprintf("lambda-%s-", trigger.Spec.FuncName))),
-		FunctionArn:    trigger.Spec.FuncName,
+		EventSourceArn:        awsutils.EventSourceArn(region, account, trigger.Spec.Type, strings.TrimPrefix(trigger.Name, fmt.Sprintf("lambda-%s-", trigger.Spec.FuncName))),
+		EventSourceMappingArn: awsutils.EventSourceMappingArn(region, account, trigger.Name),
+		FunctionArn:           awsutils.FunctionArn(region, account, trigger.Spec.FuncName, ""),
 		SelfManagedEventSource: apis.SelfManagedEventSource{
 			Endpoints: endpoints,
 		},
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// credential secrets are labelled with the access key id and the service account they act as,
+// the secret access key is kept in data. Besides its own namespace, a credential may act in
+// namespaces which trust its namespace by LambdaAnnotationTrustedNamespaces, `*` for any.
+// Trust is granted by the namespace acted in, never by the credential.
+const (
+	LambdaLabelAccessKeyID            = "lambda.refunc.io/access-key-id"
+	LambdaLabelServiceAccount         = "lambda.refunc.io/service-account"
+	LambdaAnnotationTrustedNamespaces = "lambda.refunc.io/trusted-namespaces"
+	CredentialSecretAccessKey         = "secretAccessKey"
+)
+
+const (
+	accessKeyIDIndex    = "lambda.refunc.io/access-key-id"
+	serviceAccountIndex = "lambda.refunc.io/service-account-token"
+)
+
+// Credential is the secret access key of an access key id and who it acts as,
+// the service account is in Namespace
+type Credential struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Namespace       string
+	ServiceAccount  string
+}
+
+// Credentials looks up access keys from labelled credential secrets, and legacy service account tokens
+// whose access key id is the service account name, both by informer indexes.
+type Credentials struct {
+	secrets         cache.Indexer
+	serviceAccounts corelisters.ServiceAccountLister
+	// namespaces is nil unless namespaces may trust credentials of others
+	namespaces corelisters.NamespaceLister
+	HasSynced  cache.InformerSynced
+}
+
+// NewCredentials indexes secrets, it must be called once before informers start.
+// Namespace annotations are looked up only if trustFromNamespace, which requires permission to list namespaces.
+func NewCredentials(sc sharedcfg.Configs, trustFromNamespace bool) (*Credentials, error) {
+	secretInformer := sc.KubeInformers().Core().V1().Secrets().Informer()
+	saInformer := sc.KubeInformers().Core().V1().ServiceAccounts().Informer()
+	err := secretInformer.AddIndexers(cache.Indexers{
+		accessKeyIDIndex: func(obj interface{}) ([]string, error) {
+			secret, ok := obj.(*corev1.Secret)
+			if !ok || secret.Labels[LambdaLabelAccessKeyID] == "" {
+				return nil, nil
+			}
+			return []string{secret.Labels[LambdaLabelAccessKeyID]}, nil
+		},
+		serviceAccountIndex: func(obj interface{}) ([]string, error) {
+			secret, ok := obj.(*corev1.Secret)
+			if !ok || secret.Type != corev1.SecretTypeServiceAccountToken {
+				return nil, nil
+			}
+			return []string{secret.Namespace + "/" + secret.Annotations[corev1.ServiceAccountNameKey]}, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	credentials := &Credentials{
+		secrets:         secretInformer.GetIndexer(),
+		serviceAccounts: sc.KubeInformers().Core().V1().ServiceAccounts().Lister(),
+		HasSynced: func() bool {
+			return secretInformer.HasSynced() && saInformer.HasSynced()
+		},
+	}
+	if trustFromNamespace {
+		nsInformer := sc.KubeInformers().Core().V1().Namespaces()
+		credentials.namespaces = nsInformer.Lister()
+		credentials.HasSynced = func() bool {
+			return secretInformer.HasSynced() && saInformer.HasSynced() && nsInformer.Informer().HasSynced()
+		}
+	}
+	return credentials, nil
+}
+
+// Lookup finds credential of access key id permitted in namespace, returns NotFound error if there is none.
+// A credential secret in namespace is preferred, secrets of namespaces not trusted by namespace are ignored,
+// and it fails closed if more than one secret is left.
+func (c *Credentials) Lookup(ns, accessKeyID string) (*Credential, error) {
+	objs, err := c.secrets.ByIndex(accessKeyIDIndex, accessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	var local, permitted []*corev1.Secret
+	for _, obj := range objs {
+		secret := obj.(*corev1.Secret)
+		if _, ok := secret.Data[CredentialSecretAccessKey]; !ok || secret.Labels[LambdaLabelServiceAccount] == "" {
+			continue
+		}
+		if secret.Namespace == ns {
+			local = append(local, secret)
+		} else if c.trusts(ns, secret.Namespace) {
+			permitted = append(permitted, secret)
+		}
+	}
+	if len(local) == 0 {
+		local = permitted
+	}
+	if len(local) > 1 {
+		names := make([]string, 0, len(local))
+		for _, secret := range local {
+			names = append(names, secret.Namespace+"/"+secret.Name)
+		}
+		klog.Errorf("access key %s is claimed by %d secrets %s in %s, it's rejected", accessKeyID, len(local), strings.Join(names, ", "), ns)
+		return nil, fmt.Errorf("access key %s is ambiguous", accessKeyID)
+	}
+	if len(local) == 1 {
+		secret := local[0]
+		return &Credential{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: string(secret.Data[CredentialSecretAccessKey]),
+			Namespace:       secret.Namespace,
+			ServiceAccount:  secret.Labels[LambdaLabelServiceAccount],
+		}, nil
+	}
+
+	// legacy, token of service account named access key id
+	sa, err := c.serviceAccounts.ServiceAccounts(ns).Get(accessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	objs, err = c.secrets.ByIndex(serviceAccountIndex, ns+"/"+sa.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if token, ok := obj.(*corev1.Secret).Data[corev1.ServiceAccountTokenKey]; ok {
+			return &Credential{AccessKeyID: accessKeyID, SecretAccessKey: string(token), Namespace: ns, ServiceAccount: sa.Name}, nil
+		}
+	}
+	return nil, k8serrors.NewNotFound(corev1.Resource("secrets"), sa.Name)
+}
+
+// trusts reports if credentials of home may act in ns, by annotation of ns
+func (c *Credentials) trusts(ns, home string) bool {
+	if c.namespaces == nil {
+		return false
+	}
+	namespace, err := c.namespaces.Get(ns)
+	if err != nil {
+		return false
+	}
+	for _, trusted := range strings.Split(namespace.Annotations[LambdaAnnotationTrustedNamespaces], ",") {
+		if trusted = strings.TrimSpace(trusted); trusted == "*" || trusted == home {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAccessKey generates an opaque access key id and secret access key, shaped as aws ones
+func NewAccessKey() (accessKeyID, secretAccessKey string, err error) {
+	id := make([]byte, 10)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	secret := make([]byte, 30)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	return "AKIA" + base32.StdEncoding.EncodeToString(id), base64.StdEncoding.EncodeToString(secret), nil
+}
+
+// CreateCredential mints an access key of service account, the secret is owned by and deleted with service account
+func CreateCredential(ctx context.Context, kc kubernetes.Interface, ns, serviceAccount string) (*Credential, error) {
+	sa, err := kc.CoreV1().ServiceAccounts(ns).Get(ctx, serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	accessKeyID, secretAccessKey, err := NewAccessKey()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lambda-ak-" + strings.ToLower(accessKeyID),
+			Namespace: ns,
+			Labels: map[string]string{
+				LambdaLabelAccessKeyID:    accessKeyID,
+				LambdaLabelServiceAccount: sa.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "ServiceAccount",
+				Name:       sa.Name,
+				UID:        sa.UID,
+			}},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			CredentialSecretAccessKey: []byte(secretAccessKey),
+		},
+	}
+	if _, err := kc.CoreV1().Secrets(ns).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return nil, err
+	}
+	return &Credential{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, Namespace: ns, ServiceAccount: sa.Name}, nil
+}
+
+// DeleteCredentials deletes access keys of service account but keep, returns the deleted access key ids
+func DeleteCredentials(ctx context.Context, kc kubernetes.Interface, ns, serviceAccount, keep string) ([]string, error) {
+	selector := labels.Set{LambdaLabelServiceAccount: serviceAccount}.String() + "," + LambdaLabelAccessKeyID
+	secrets, err := kc.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, secret := range secrets.Items {
+		accessKeyID := secret.Labels[LambdaLabelAccessKeyID]
+		if accessKeyID == keep {
+			continue
+		}
+		if err := kc.CoreV1().Secrets(ns).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted = append(deleted, accessKeyID)
+	}
+	return deleted, nil
+}
@@ -19,56 +19,60 @@ import (
 	"github.com/robfig/cron"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func CreateEventSource(c *gin.Context) {
 	var payload apis.EventSourceMappingConfiguration
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidRequestContent.WithMessage("%v", err))
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	region := c.GetString("region")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, payload.FunctionName)
+	if !ok {
+		return
+	}
+	payload.FunctionName = functionName
 
-	funcdef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), payload.FunctionArn, metav1.GetOptions{})
+	funcdef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), payload.FunctionName, metav1.GetOptions{})
 	if err != nil && !k8serrors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if k8serrors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", payload.FunctionName))
 		return
 	}
 
 	triggerInfo, err := triggerCutter(funcdef, payload)
 	if err != nil {
-		klog.Errorf("create trigger info error %v", err)
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+		utils.Log(c).Errorf("create trigger info error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue)
 		return
 	}
 
 	trigger, err := refuncClient.RefuncV1beta3().Triggers(region).Create(context.TODO(), triggerInfo, metav1.CreateOptions{})
 	if err != nil {
-		klog.Errorf("create trigger error %v", err)
+		utils.Log(c).Errorf("create trigger error %v", err)
 		if strings.Contains(err.Error(), "exists") {
-			awsutils.AWSErrorResponse(c, 409, "ResourceConflictException")
+			awsutils.ErrorResponse(c, awsutils.ErrResourceConflict)
 		} else {
-			awsutils.AWSErrorResponse(c, 500, "ServiceException")
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		}
 		return
 	}
 
-	eventConfig, err := controllers.TriggerToEventSourceConfig(*trigger)
+	eventConfig, err := controllers.TriggerToEventSourceConfig(*trigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("trigger to lambda event source error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("trigger to lambda event source error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -76,12 +80,14 @@ func CreateEventSource(c *gin.Context) {
 }
 
 func triggerCutter(funcdef *rfv1beta3.Funcdef, ec apis.EventSourceMappingConfiguration) (*rfv1beta3.Trigger, error) {
-	arns := strings.Split(ec.EventSourceArn, ":")
-	if len(arns) != 3 {
-		return nil, fmt.Errorf("event arn %s format error", ec.EventSourceArn)
+	triggerType, triggerName, err := awsutils.ParseEventSourceArn(ec.EventSourceArn)
+	if err != nil {
+		return nil, err
+	}
+	if triggerName == "" {
+		return nil, fmt.Errorf("event arn %s has no name", ec.EventSourceArn)
 	}
-	triggerType, triggerName := arns[1], arns[2]
-	triggerName = fmt.Sprintf("lambda-%s-%s", ec.FunctionArn, triggerName)
+	triggerName = fmt.Sprintf("lambda-%s-%s", ec.FunctionName, triggerName)
 	trigger := &rfv1beta3.Trigger{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: funcdef.Namespace,
@@ -8,7 +8,6 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func DeleteEventSource(c *gin.Context) {
@@ -16,27 +15,27 @@ func DeleteEventSource(c *gin.Context) {
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	trigger, err := refuncClient.RefuncV1beta3().Triggers(region).Get(context.TODO(), triggerName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get httptrigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get httptrigger error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
 	err = refuncClient.RefuncV1beta3().Triggers(region).Delete(context.TODO(), trigger.Name, metav1.DeleteOptions{})
 	if err != nil {
-		klog.Errorf("delete trigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("delete trigger error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -4,7 +4,6 @@ import (
 	"context"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/refunc/aws-api-gw/pkg/apis"
@@ -13,7 +12,6 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func GetEventSource(c *gin.Context) {
@@ -21,27 +19,27 @@ func GetEventSource(c *gin.Context) {
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	trigger, err := refuncClient.RefuncV1beta3().Triggers(region).Get(context.TODO(), triggerName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get trigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get trigger error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
-	eventConfig, err := controllers.TriggerToEventSourceConfig(*trigger)
+	eventConfig, err := controllers.TriggerToEventSourceConfig(*trigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("trigger to lambda event source error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("trigger to lambda event source error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -49,28 +47,35 @@ func GetEventSource(c *gin.Context) {
 }
 
 func ListEventSource(c *gin.Context) {
-	arnInfo := strings.Split(c.Query("EventSourceArn"), ":")
-	if len(arnInfo) < 2 {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	sourceType, _, err := awsutils.ParseEventSourceArn(c.Query("EventSourceArn"))
+	if err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("%v", err))
 		return
 	}
-	triggerType, err := controllers.GetArnTriggerType(arnInfo[1])
+	triggerType, err := controllers.GetArnTriggerType(sourceType)
 	if err != nil {
-		klog.Errorf("arn info params error %v", err)
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+		utils.Log(c).Errorf("arn info params error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue)
 		return
 	}
 	if triggerType == controllers.HTTPTriggerType {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException HTTPTriger Managed by FunctionURL")
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("HTTP triggers are managed by function url."))
 		return
 	}
+	var ok bool
+	functionName := c.Query("FunctionName")
+	if functionName != "" {
+		if functionName, ok = controllers.ResolveUnqualifiedFunctionName(c, functionName); !ok {
+			return
+		}
+	}
 	options := metav1.ListOptions{
-		LabelSelector: controllers.LambdaLabelTriggerType + "=" + triggerType + "," + controllers.LambdaLabelFuncdef + "=" + c.Query("FunctionName"),
+		LabelSelector: controllers.LambdaLabelTriggerType + "=" + triggerType + "," + controllers.LambdaLabelFuncdef + "=" + functionName,
 	}
 	if triggerType == "*" {
 		// list any type trigger, except http trigger
 		options = metav1.ListOptions{
-			LabelSelector: controllers.LambdaLabelTriggerType + "!=" + controllers.HTTPTriggerType + "," + controllers.LambdaLabelFuncdef + "=" + c.Query("FunctionName"),
+			LabelSelector: controllers.LambdaLabelTriggerType + "!=" + controllers.HTTPTriggerType + "," + controllers.LambdaLabelFuncdef + "=" + functionName,
 		}
 	}
 	limit, err := strconv.Atoi(c.Query("MaxItems"))
@@ -84,29 +89,29 @@ func ListEventSource(c *gin.Context) {
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	triggers, err := refuncClient.RefuncV1beta3().Triggers(region).List(context.TODO(), options)
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("list triggers error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("list triggers error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
 	events := []apis.EventSourceMappingConfiguration{}
 
 	for _, item := range triggers.Items {
-		eventConfig, err := controllers.TriggerToEventSourceConfig(item)
+		eventConfig, err := controllers.TriggerToEventSourceConfig(item, c.GetString("awsRegion"), c.GetString("accountID"))
 		if err != nil {
-			klog.Errorf("trigger to lambda configuration error %v", err)
-			awsutils.AWSErrorResponse(c, 500, "ServiceException")
+			utils.Log(c).Errorf("trigger to lambda configuration error %v", err)
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 			return
 		}
 		events = append(events, eventConfig)
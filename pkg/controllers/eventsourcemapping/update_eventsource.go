@@ -8,5 +8,5 @@ import (
 func UpdateEventSource(c *gin.Context) {
 	//No suitable field to carry the payload, please fallback use delete&create to update.
 	//https://docs.aws.amazon.com/lambda/latest/api/API_UpdateEventSourceMapping.html
-	awsutils.AWSErrorResponse(c, 500, "ServiceException")
+	awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("Updating event source mapping %s is not supported, delete and create it instead.", c.Param("EventSourceName")))
 }
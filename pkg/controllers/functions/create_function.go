@@ -2,8 +2,6 @@ package functions
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
@@ -16,38 +14,56 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/utils/rfutils"
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/validation"
-	"k8s.io/klog/v2"
 )
 
 func CreateFunction(c *gin.Context) {
 	var payload apis.CreateFunctionRequest
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	zip, err := bindCodeJSON(c, &payload, "Code", "ZipFile")
+	if err != nil {
+		utils.Log(c).Errorf("bind create function request error %v", err)
+		codeErrorResponse(c, err)
 		return
 	}
+	if zip != nil {
+		defer zip.Close()
+		delete(payload.Code, "ZipFile")
+	}
 
-	if errs := validation.IsDNS1123Label(payload.FunctionName); len(errs) > 0 {
-		awsutils.AWSErrorResponse(c, 400, "InvalidFunctionNameException")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, payload.FunctionName)
+	if !ok {
+		return
+	}
+	payload.FunctionName = functionName
+	runtimes, err := listRuntimes(c)
+	if err != nil {
+		utils.Log(c).Errorf("list runtimes error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+	if validateCreateFunction(&payload, zip != nil, runtimes).response(c) {
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	region := c.GetString("region")
-	body, codeSize, hash, err := services.SetFunctionCode(payload.Code, region, payload.FunctionName)
+	if err := services.CheckStagingOwner(payload.Code, region, controllers.CallerIdentity(c)); err != nil {
+		utils.Log(c).Errorf("check staged code error %v", err)
+		codeErrorResponse(c, err)
+		return
+	}
+	fnCode, err := services.SetFunctionCode(payload.Code, zip, region, payload.FunctionName)
 	if err != nil {
-		klog.Errorf("set function code error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("set function code error %v", err)
+		codeErrorResponse(c, err)
 		return
 	}
 	timeout := rfutils.GetTimeout(int(payload.Timeout))
 
-	// apply funcdef
-	funcdef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Create(context.TODO(), &rfv1beta3.Funcdef{
+	funcdef := &rfv1beta3.Funcdef{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: rfv1beta3.APIVersion,
 			Kind:       rfv1beta3.FuncdefKind,
@@ -62,31 +78,36 @@ func CreateFunction(c *gin.Context) {
 			Annotations: map[string]string{},
 		},
 		Spec: rfv1beta3.FuncdefSpec{
-			Body:  body,
-			Hash:  hash,
 			Entry: payload.Handler,
 			Runtime: &rfv1beta3.Runtime{
 				Name:    payload.Runtime,
 				Envs:    payload.Environment.Variables,
 				Timeout: timeout,
 			},
-			Custom: json.RawMessage(fmt.Sprintf(`{"codeSize":%d}`, codeSize)),
 		},
-	}, metav1.CreateOptions{})
+	}
+	if err := controllers.SetFuncdefCode(funcdef, fnCode); err != nil {
+		utils.Log(c).Errorf("set funcdef code error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+
+	// apply funcdef
+	funcdef, err = refuncClient.RefuncV1beta3().Funcdeves(region).Create(context.TODO(), funcdef, metav1.CreateOptions{})
 	if err != nil {
-		klog.Errorf("create funcdef error %v", err)
+		utils.Log(c).Errorf("create funcdef error %v", err)
 		if strings.Contains(err.Error(), "exists") {
-			awsutils.AWSErrorResponse(c, 409, "ResourceConflictException")
+			awsutils.ErrorResponse(c, awsutils.ErrResourceConflict)
 		} else {
-			awsutils.AWSErrorResponse(c, 500, "ServiceException")
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		}
 		return
 	}
 
-	fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(*funcdef)
+	fnConfiguration, err := lambdaConfiguration(c, funcdef)
 	if err != nil {
-		klog.Errorf("funcdef to lambda configuration error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -2,51 +2,199 @@ package functions
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
 	"github.com/refunc/aws-api-gw/pkg/services"
 	"github.com/refunc/aws-api-gw/pkg/utils"
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	rfclientset "github.com/refunc/refunc/pkg/generated/clientset/versioned"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 )
 
 func DeleteFunction(c *gin.Context) {
-	functionName := c.Param("FunctionName")
-	//TODO support get function Qualifier
+	functionName, qualifier, ok := controllers.ResolveFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	fndef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), functionName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
+		return
+	}
+
+	if !controllers.IsLatest(qualifier) && qualifier != controllers.LambdaVersion {
+		deleteFunctionVersion(c, refuncClient, fndef, qualifier)
+		return
+	}
+
+	// dependents go first, the funcdef is deleted last so a failed delete can be retried as a whole
+	step, err := deleteFunctionDependents(refuncClient, fndef)
+	if err != nil {
+		utils.Log(c).Errorf("delete function %s/%s error at %s, %v", region, functionName, step, err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException.WithMessage("Deleting %s of function failed, the function is not deleted, retry the request.", step))
 		return
 	}
 
-	err = refuncClient.RefuncV1beta3().Funcdeves(region).Delete(context.TODO(), fndef.Name, metav1.DeleteOptions{})
+	err = deleteWithRetry(func() error {
+		return refuncClient.RefuncV1beta3().Funcdeves(region).Delete(context.TODO(), fndef.Name, metav1.DeleteOptions{})
+	})
 	if err != nil {
-		klog.Errorf("delete funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("delete funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException.WithMessage("Deleting function failed, the function is not deleted, retry the request."))
+		return
+	}
+
+	// funcdef is gone, leftover code is reclaimed by code gc
+	if err := services.DelFunctionCode(fndef.Spec.Body); err != nil {
+		utils.Log(c).Errorf("delete function code error %v", err)
+	}
+
+	c.AbortWithStatus(204)
+}
+
+// deleteFunctionVersion deletes a published version, its code is deleted unless still referenced
+func deleteFunctionVersion(c *gin.Context, refuncClient rfclientset.Interface, fndef *rfv1beta3.Funcdef, version string) {
+	versionName := controllers.VersionFuncdefName(fndef.Name, version)
+	versionFndef, err := refuncClient.RefuncV1beta3().Funcdeves(fndef.Namespace).Get(context.TODO(), versionName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		utils.Log(c).Errorf("get funcdef version error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+	if errors.IsNotFound(err) || versionFndef.Labels[controllers.LambdaLabelVersionOf] != fndef.Name {
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s:%s", fndef.Name, version))
 		return
 	}
 
-	err = services.DelFunctionCode(fndef.Spec.Body)
+	err = deleteWithRetry(func() error {
+		return refuncClient.RefuncV1beta3().Funcdeves(fndef.Namespace).Delete(context.TODO(), versionName, metav1.DeleteOptions{})
+	})
 	if err != nil {
-		klog.Errorf("delete funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("delete funcdef version error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
+	body := versionFndef.Spec.Body
+	if body != fndef.Spec.Body {
+		funcdefLister, err := utils.GetFuncdefLister(c)
+		if err != nil {
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+			return
+		}
+		// the lister may still see the deleted version, it is skipped by name
+		versions, err := funcdefLister.Funcdeves(fndef.Namespace).List(labels.SelectorFromSet(labels.Set{
+			controllers.LambdaLabelVersionOf: fndef.Name,
+		}))
+		if err == nil {
+			inUse := false
+			for _, v := range versions {
+				if v.Name != versionName && v.Spec.Body == body {
+					inUse = true
+					break
+				}
+			}
+			if !inUse {
+				if err := services.DelFunctionCode(body); err != nil {
+					utils.Log(c).Errorf("delete function code error %v", err)
+				}
+			}
+		}
+	}
+
 	c.AbortWithStatus(204)
 }
+
+// deleteFunctionDependents deletes url, event source triggers and versions of function in order,
+// returns the failed step if any
+func deleteFunctionDependents(refuncClient rfclientset.Interface, fndef *rfv1beta3.Funcdef) (string, error) {
+	ns := fndef.Namespace
+	triggers, err := refuncClient.RefuncV1beta3().Triggers(ns).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{controllers.LambdaLabelFuncdef: fndef.Name}).String(),
+	})
+	if err != nil {
+		return "triggers", err
+	}
+	// url first, stop public traffic before anything else
+	var urls, eventSources []string
+	for _, trigger := range triggers.Items {
+		if trigger.Spec.Type == controllers.HTTPTriggerType && strings.HasPrefix(trigger.Name, "lambda-http-") {
+			urls = append(urls, trigger.Name)
+		} else {
+			eventSources = append(eventSources, trigger.Name)
+		}
+	}
+	for _, name := range urls {
+		err := deleteWithRetry(func() error {
+			return refuncClient.RefuncV1beta3().Triggers(ns).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		})
+		if err != nil {
+			return "url " + name, err
+		}
+	}
+	for _, name := range eventSources {
+		err := deleteWithRetry(func() error {
+			return refuncClient.RefuncV1beta3().Triggers(ns).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		})
+		if err != nil {
+			return "event source mapping " + name, err
+		}
+	}
+
+	versions, err := refuncClient.RefuncV1beta3().Funcdeves(ns).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{controllers.LambdaLabelVersionOf: fndef.Name}).String(),
+	})
+	if err != nil {
+		return "versions", err
+	}
+	bodies := map[string]struct{}{}
+	for _, version := range versions.Items {
+		err := deleteWithRetry(func() error {
+			return refuncClient.RefuncV1beta3().Funcdeves(ns).Delete(context.TODO(), version.Name, metav1.DeleteOptions{})
+		})
+		if err != nil {
+			return "version " + version.Labels[rfv1beta3.LabelLambdaVersion], err
+		}
+		bodies[version.Spec.Body] = struct{}{}
+	}
+	// code of latest is deleted with funcdef
+	delete(bodies, fndef.Spec.Body)
+	for body := range bodies {
+		if err := services.DelFunctionCode(body); err != nil {
+			klog.Errorf("delete function code error %v", err)
+		}
+	}
+	return "", nil
+}
+
+// deleteWithRetry retries transient errors of delete, not found is treated as deleted
+func deleteWithRetry(del func() error) error {
+	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return errors.IsServerTimeout(err) || errors.IsTimeout(err) || errors.IsTooManyRequests(err) || errors.IsInternalError(err) || errors.IsServiceUnavailable(err)
+	}, func() error {
+		if err := del(); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+}
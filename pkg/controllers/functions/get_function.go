@@ -8,40 +8,42 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/refunc/aws-api-gw/pkg/apis"
 	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/aws-api-gw/pkg/services"
 	"github.com/refunc/aws-api-gw/pkg/utils"
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func GetFunction(c *gin.Context) {
-	functionName := c.Param("FunctionName")
-	//TODO support get function Qualifier
+	functionName, qualifier, ok := controllers.ResolveFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
-	fndef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), functionName, metav1.GetOptions{})
+	fndef, err := getQualifiedFuncdef(refuncClient, region, functionName, qualifier)
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", qualifiedName(functionName, qualifier)))
 		return
 	}
 
-	fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(*fndef)
+	fnConfiguration, err := lambdaConfiguration(c, fndef)
 	if err != nil {
-		klog.Errorf("funcdef to lambda configuration error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -53,9 +55,17 @@ func GetFunction(c *gin.Context) {
 		}
 	}
 
+	location, repositoryType, err := services.CodeLocation(fndef.Spec.Body)
+	if err != nil {
+		utils.Log(c).Errorf("presign function code location error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+
 	c.JSON(http.StatusOK, apis.GetFunctionResponse{
 		Code: map[string]string{
-			"Location": fndef.Spec.Body,
+			"Location":       location,
+			"RepositoryType": repositoryType,
 		},
 		Configuration: fnConfiguration,
 		Concurrency: apis.FunctionConcurrencyConfig{
@@ -64,9 +74,46 @@ func GetFunction(c *gin.Context) {
 	})
 }
 
+func GetFunctionConfiguration(c *gin.Context) {
+	functionName, qualifier, ok := controllers.ResolveFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
+
+	refuncClient, err := utils.GetRefuncClient(c)
+	if err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+
+	region := c.GetString("region")
+	fndef, err := getQualifiedFuncdef(refuncClient, region, functionName, qualifier)
+	if err != nil && !errors.IsNotFound(err) {
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+	if errors.IsNotFound(err) {
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", qualifiedName(functionName, qualifier)))
+		return
+	}
+
+	fnConfiguration, err := lambdaConfiguration(c, fndef)
+	if err != nil {
+		utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+
+	c.JSON(http.StatusOK, fnConfiguration)
+}
+
 func ListFunction(c *gin.Context) {
 	//TODO support list function FunctionVersion MasterRegion
-	options := metav1.ListOptions{}
+	options := metav1.ListOptions{
+		// published versions are not listed as functions
+		LabelSelector: "!" + controllers.LambdaLabelVersionOf,
+	}
 	limit, err := strconv.Atoi(c.Query("MaxItems"))
 	if err == nil && limit > 0 {
 		options.Limit = int64(limit)
@@ -78,29 +125,29 @@ func ListFunction(c *gin.Context) {
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	fndeves, err := refuncClient.RefuncV1beta3().Funcdeves(region).List(context.TODO(), options)
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("list funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("list funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
 	functions := []apis.FunctionConfiguration{}
 
 	for _, fndef := range fndeves.Items {
-		fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(fndef)
+		fnConfiguration, err := lambdaConfiguration(c, &fndef)
 		if err != nil {
-			klog.Errorf("funcdef to lambda configuration error %v", err)
-			awsutils.AWSErrorResponse(c, 500, "ServiceException")
+			utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 			return
 		}
 		functions = append(functions, fnConfiguration)
@@ -14,44 +14,50 @@ import (
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"github.com/refunc/refunc/pkg/client"
 	"github.com/refunc/refunc/pkg/messages"
-	rfutils "github.com/refunc/refunc/pkg/utils"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/klog/v2"
 )
 
 func InvokeFunction(c *gin.Context) {
-	functionName := c.Param("FunctionName")
-	//TODO support get function Qualifier
+	functionName, qualifier, ok := controllers.ResolveFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	var args json.RawMessage
-	if err := c.BindJSON(&args); err != nil {
-		klog.Error(err)
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	if err := c.ShouldBindJSON(&args); err != nil {
+		utils.Log(c).Error(err)
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidRequestContent.WithMessage("%v", err))
 		return
 	}
 
 	funcdefLister, err := utils.GetFuncdefLister(c)
 	if err != nil {
-		klog.Error(err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Error(err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	natsConn, err := utils.GetNatsConn(c)
 	if err != nil {
-		klog.Error(err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Error(err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
-	fndef, err := funcdefLister.Funcdeves(region).Get(functionName)
+	fndefName, ok := controllers.QualifiedFuncdefName(functionName, qualifier)
+	if !ok {
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", qualifiedName(functionName, qualifier)))
+		return
+	}
+	fndef, err := funcdefLister.Funcdeves(region).Get(fndefName)
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
-	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+	if errors.IsNotFound(err) || !controllers.IsFuncdefOf(fndef, functionName) {
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", qualifiedName(functionName, qualifier)))
 		return
 	}
 
@@ -70,7 +76,7 @@ func InvokeFunction(c *gin.Context) {
 	} else if invocationType == "DryRun" {
 		c.AbortWithStatus(204)
 	} else {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue)
 	}
 }
 
@@ -79,7 +85,7 @@ var TailLogSize = 4096 //4KB
 func invokeRequestResponse(c *gin.Context, natsConn *nats.Conn, args json.RawMessage, logType string, fndef *rfv1beta3.Funcdef) {
 	request := &messages.InvokeRequest{
 		Args:      args,
-		RequestID: rfutils.GenID(args),
+		RequestID: utils.GetRequestID(c),
 	}
 	endpoint := fndef.Namespace + "/" + fndef.Name
 
@@ -92,10 +98,11 @@ func invokeRequestResponse(c *gin.Context, natsConn *nats.Conn, args json.RawMes
 	if logType == "Tail" {
 		ctx = client.WithLoggingHint(ctx, true)
 	}
+	utils.Log(c).V(1).Infof("invoke %s", endpoint)
 	taskr, err := client.NewTaskResolver(ctx, endpoint, request)
 	if err != nil {
-		klog.Error(err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("invoke %s error %v", endpoint, err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	logStream := taskr.LogObserver()
@@ -112,7 +119,11 @@ func invokeRequestResponse(c *gin.Context, natsConn *nats.Conn, args json.RawMes
 				bts = messages.GetErrActionBytes(err)
 			}
 			c.Status(200)
-			c.Header(controllers.HeaderAmzExecutedVersion, controllers.LambdaVersion)
+			executedVersion := controllers.LambdaVersion
+			if _, ok := fndef.Labels[controllers.LambdaLabelVersionOf]; ok {
+				executedVersion = fndef.Labels[rfv1beta3.LabelLambdaVersion]
+			}
+			c.Header(controllers.HeaderAmzExecutedVersion, executedVersion)
 			if logType == "Tail" {
 				logStr := ""
 				if len(logs) > TailLogSize {
@@ -130,5 +141,5 @@ func invokeRequestResponse(c *gin.Context, natsConn *nats.Conn, args json.RawMes
 
 func invokeEvent(c *gin.Context, natsConn *nats.Conn, args json.RawMessage, fndef *rfv1beta3.Funcdef) {
 	// TODO support asynchronously invoke
-	awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue)
 }
@@ -2,8 +2,6 @@ package functions
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,34 +10,49 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/services"
 	"github.com/refunc/aws-api-gw/pkg/utils"
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func UpdateFunctionCode(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	var payload apis.UpdateFunctionCodeRequest
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	zip, err := bindCodeJSON(c, &payload, "ZipFile")
+	if err != nil {
+		utils.Log(c).Errorf("bind update function code request error %v", err)
+		codeErrorResponse(c, err)
+		return
+	}
+	if zip != nil {
+		defer zip.Close()
+	}
+	if validateUpdateFunctionCode(&payload, zip != nil).response(c) {
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	fndef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), functionName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
+		return
+	}
+	if payload.RevisionId != "" && payload.RevisionId != fndef.ResourceVersion {
+		awsutils.ErrorResponse(c, awsutils.ErrPreconditionFailed)
 		return
 	}
 
@@ -48,40 +61,96 @@ func UpdateFunctionCode(c *gin.Context) {
 	if payload.S3Bucket != "" && payload.S3Key != "" {
 		code["S3Bucket"] = payload.S3Bucket
 		code["S3Key"] = payload.S3Key
+		if payload.S3ObjectVersion != "" {
+			code["S3ObjectVersion"] = payload.S3ObjectVersion
+		}
+	}
+	if err := services.CheckStagingOwner(code, region, controllers.CallerIdentity(c)); err != nil {
+		utils.Log(c).Errorf("check staged code error %v", err)
+		codeErrorResponse(c, err)
+		return
 	}
-	if payload.ZipFile != "" {
-		code["ZipFile"] = payload.ZipFile
+
+	if payload.DryRun {
+		// validate code only, funcdef and code storage keep untouched
+		fnCode, err := services.CheckFunctionCode(code, zip, region)
+		if err != nil {
+			utils.Log(c).Errorf("check function code error %v", err)
+			codeErrorResponse(c, err)
+			return
+		}
+		if err := controllers.SetFuncdefCode(fndef, fnCode); err != nil {
+			utils.Log(c).Errorf("set funcdef code error %v", err)
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+			return
+		}
+		fnConfiguration, err := lambdaConfiguration(c, fndef)
+		if err != nil {
+			utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+			return
+		}
+		c.JSON(http.StatusOK, apis.UpdateFunctionCodeResponse{
+			FunctionConfiguration: fnConfiguration,
+		})
+		return
+	}
+
+	fnCode, err := services.SetFunctionCode(code, zip, region, functionName)
+	if err != nil {
+		utils.Log(c).Errorf("set function code error %v", err)
+		codeErrorResponse(c, err)
+		return
+	}
+
+	// apply funcdef
+	var originBody string
+	var published *rfv1beta3.Funcdef
+	if payload.Publish {
+		fndef, published, originBody, err = publishCode(refuncClient, region, functionName, payload.RevisionId, fnCode)
+	} else {
+		fndef, err = controllers.UpdateFuncdef(refuncClient, region, functionName, payload.RevisionId, func(fndef *rfv1beta3.Funcdef) error {
+			originBody = fndef.Spec.Body
+			return controllers.SetFuncdefCode(fndef, fnCode)
+		})
 	}
-	body, codeSize, hash, err := services.SetFunctionCode(code, region, functionName)
 	if err != nil {
-		klog.Errorf("set function code error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("update funcdef code error %v", err)
+		if err == controllers.ErrPreconditionFailed {
+			awsutils.ErrorResponse(c, awsutils.ErrPreconditionFailed)
+		} else if errors.IsNotFound(err) {
+			awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
+		} else {
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		}
 		return
 	}
-	if body != fndef.Spec.Body {
-		originBody := fndef.Spec.Body
+	if fnCode.Body != originBody {
+		funcdefLister, err := utils.GetFuncdefLister(c)
+		if err != nil {
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+			return
+		}
+		// eager cleanup, failures are reclaimed by code gc
+		log := utils.Log(c)
 		go func() {
+			if inUse, err := codeInUse(funcdefLister, region, functionName, originBody); err != nil || inUse {
+				return
+			}
 			if err := services.DelFunctionCode(originBody); err != nil {
-				klog.Errorf("del function code error %v", err)
+				log.Errorf("del function code error %v", err)
 			}
 		}()
 	}
-	fndef.Spec.Body = body
-	fndef.Spec.Hash = hash
-	fndef.Spec.Custom = json.RawMessage(fmt.Sprintf(`{"codeSize":%d}`, codeSize))
 
-	// apply funcdef
-	fndef, err = refuncClient.RefuncV1beta3().Funcdeves(region).Update(context.TODO(), fndef, metav1.UpdateOptions{})
-	if err != nil {
-		klog.Errorf("update funcdef code error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
-		return
+	if published != nil {
+		fndef = published
 	}
 
-	fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(*fndef)
+	fnConfiguration, err := lambdaConfiguration(c, fndef)
 	if err != nil {
-		klog.Errorf("funcdef to lambda configuration error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -91,57 +160,80 @@ func UpdateFunctionCode(c *gin.Context) {
 }
 
 func UpdateFunctionConfiguration(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	var payload apis.UpdateFunctionConfigurationRequest
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidRequestContent.WithMessage("%v", err))
+		return
+	}
+	runtimes, err := listRuntimes(c)
+	if err != nil {
+		utils.Log(c).Errorf("list runtimes error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+	if validateUpdateFunctionConfiguration(&payload, runtimes).response(c) {
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	fndef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), functionName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
 		return
 	}
 
-	// update function configuration
-	if payload.Handler != "" {
-		fndef.Spec.Entry = payload.Handler
-	}
-	if payload.Runtime != "" {
-		fndef.Spec.Runtime.Name = payload.Runtime
-	}
-	if payload.Timeout > 0 {
-		fndef.Spec.Runtime.Timeout = int(payload.Timeout)
-	}
-	if payload.Environment.Variables != nil && len(payload.Environment.Variables) > 0 {
-		fndef.Spec.Runtime.Envs = payload.Environment.Variables
+	if payload.RevisionId != "" && payload.RevisionId != fndef.ResourceVersion {
+		awsutils.ErrorResponse(c, awsutils.ErrPreconditionFailed)
+		return
 	}
 
-	// apply funcdef
-	fndef, err = refuncClient.RefuncV1beta3().Funcdeves(region).Update(context.TODO(), fndef, metav1.UpdateOptions{})
+	// update function configuration and apply funcdef
+	fndef, err = controllers.UpdateFuncdef(refuncClient, region, functionName, payload.RevisionId, func(fndef *rfv1beta3.Funcdef) error {
+		if payload.Handler != "" {
+			fndef.Spec.Entry = payload.Handler
+		}
+		if payload.Runtime != "" {
+			fndef.Spec.Runtime.Name = payload.Runtime
+		}
+		if payload.Timeout > 0 {
+			fndef.Spec.Runtime.Timeout = int(payload.Timeout)
+		}
+		if payload.Environment.Variables != nil && len(payload.Environment.Variables) > 0 {
+			fndef.Spec.Runtime.Envs = payload.Environment.Variables
+		}
+		return nil
+	})
 	if err != nil {
-		klog.Errorf("update funcdef configuration error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("update funcdef configuration error %v", err)
+		if err == controllers.ErrPreconditionFailed {
+			awsutils.ErrorResponse(c, awsutils.ErrPreconditionFailed)
+		} else if errors.IsNotFound(err) {
+			awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
+		} else {
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		}
 		return
 	}
 
-	fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(*fndef)
+	fnConfiguration, err := lambdaConfiguration(c, fndef)
 	if err != nil {
-		klog.Errorf("funcdef to lambda configuration error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("funcdef to lambda configuration error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -0,0 +1,76 @@
+package functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/apis"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/aws-api-gw/pkg/services"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+)
+
+// lambdaConfiguration converts funcdef to lambda configuration with lifecycle states
+func lambdaConfiguration(c *gin.Context, fndef *rfv1beta3.Funcdef) (apis.FunctionConfiguration, error) {
+	fnConfiguration, err := controllers.FuncdefToLambdaConfiguration(*fndef, c.GetString("awsRegion"), c.GetString("accountID"))
+	if err != nil {
+		return fnConfiguration, err
+	}
+	xenvLister, err := utils.GetXenvLister(c)
+	if err != nil {
+		return fnConfiguration, err
+	}
+	funcinstLister, err := utils.GetFuncinstLister(c)
+	if err != nil {
+		return fnConfiguration, err
+	}
+	err = controllers.SetLambdaState(&fnConfiguration, fndef, xenvLister, funcinstLister)
+	return fnConfiguration, err
+}
+
+// codeErrorResponse writes aws error for a failed code source
+func codeErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidZipFile):
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidZipFile.WithMessage("%v", err))
+	case errors.Is(err, services.ErrRequestTooLarge):
+		awsutils.ErrorResponse(c, awsutils.ErrRequestTooLarge.WithMessage("%v", err))
+	case errors.Is(err, services.ErrCodeStorageExceeded):
+		awsutils.ErrorResponse(c, awsutils.ErrCodeStorageExceeded.WithMessage("%v", err))
+	case errors.Is(err, services.ErrStagingAccessDenied), errors.Is(err, services.ErrCodeAccessDenied):
+		awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("%v", err))
+	case errors.Is(err, services.ErrInvalidCode):
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("%v", err))
+	default:
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+	}
+}
+
+// bindCodeJSON binds request json into payload, the ZipFile at path is spooled to disk instead of memory.
+// A nil ZipFile is returned if request has no ZipFile, otherwise caller must close it.
+func bindCodeJSON(c *gin.Context, payload interface{}, path ...string) (*services.ZipFile, error) {
+	var zip *services.ZipFile
+	doc, _, err := utils.StreamJSONString(c.Request.Body, path, func() (io.Writer, error) {
+		var err error
+		zip, err = services.NewZipFile()
+		return zip, err
+	})
+	if err == nil {
+		err = json.Unmarshal(doc, payload)
+	}
+	if err != nil && !errors.Is(err, services.ErrInvalidZipFile) && !errors.Is(err, services.ErrRequestTooLarge) {
+		err = fmt.Errorf("%w: %v", services.ErrInvalidCode, err)
+	}
+	if err != nil {
+		if zip != nil {
+			zip.Close()
+		}
+		return nil, err
+	}
+	return zip, nil
+}
@@ -0,0 +1,200 @@
+package functions
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/apis"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// limits of aws lambda, see https://docs.aws.amazon.com/lambda/latest/dg/gettingstarted-limits.html
+const (
+	minTimeout         = 1
+	maxTimeout         = 900
+	minMemorySize      = 128
+	maxMemorySize      = 10240
+	maxDescription     = 256
+	maxHandler         = 128
+	maxEnvironment     = 4 * 1024
+	maxS3Key           = 1024
+	maxS3Bucket        = 63
+	maxFunctionName    = 64
+	maxArchitectures   = 1
+	maxS3ObjectVersion = 1024
+)
+
+var (
+	handlerPattern  = regexp.MustCompile(`^[^\s]+$`)
+	envKeyPattern   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+	s3BucketPattern = regexp.MustCompile(`^[0-9A-Za-z\.\-_]*(?:[0-9A-Za-z\.\-_])$`)
+
+	architectures = map[string]struct{}{"x86_64": {}, "arm64": {}}
+
+	// environment variables set by lambda runtime, users can't override them, nor any with reservedEnvPrefix
+	reservedEnvKeys = map[string]struct{}{
+		"_HANDLER":           {},
+		"_X_AMZN_TRACE_ID":   {},
+		"LAMBDA_TASK_ROOT":   {},
+		"LAMBDA_RUNTIME_DIR": {},
+	}
+)
+
+const reservedEnvPrefix = "AWS_"
+
+// validationErrors collects constraint violations the aws way
+type validationErrors []string
+
+func (v *validationErrors) add(value interface{}, field, constraint string) {
+	*v = append(*v, fmt.Sprintf("Value '%v' at '%s' failed to satisfy constraint: %s", value, field, constraint))
+}
+
+// response writes InvalidParameterValueException if any violation, reports if it's written
+func (v validationErrors) response(c *gin.Context) bool {
+	if len(v) == 0 {
+		return false
+	}
+	noun := "error"
+	if len(v) > 1 {
+		noun = "errors"
+	}
+	awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("%d validation %s detected: %s", len(v), noun, strings.Join(v, "; ")))
+	return true
+}
+
+// runtimeSet is the sorted names of xenvs in namespace, runtimes of lambda are xenvs of refunc
+type runtimeSet []string
+
+func listRuntimes(c *gin.Context) (runtimeSet, error) {
+	xenvLister, err := utils.GetXenvLister(c)
+	if err != nil {
+		return nil, err
+	}
+	xenvs, err := xenvLister.Xenvs(c.GetString("region")).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	runtimes := make(runtimeSet, 0, len(xenvs))
+	for _, xenv := range xenvs {
+		runtimes = append(runtimes, xenv.Name)
+	}
+	sort.Strings(runtimes)
+	return runtimes, nil
+}
+
+func (r runtimeSet) has(name string) bool {
+	i := sort.SearchStrings(r, name)
+	return i < len(r) && r[i] == name
+}
+
+func validateCreateFunction(payload *apis.CreateFunctionRequest, hasZip bool, runtimes runtimeSet) validationErrors {
+	var errs validationErrors
+	if len(payload.FunctionName) == 0 || len(payload.FunctionName) > maxFunctionName {
+		errs.add(payload.FunctionName, "functionName", fmt.Sprintf("Member must have length between 1 and %d", maxFunctionName))
+	} else if msgs := validation.IsDNS1123Label(payload.FunctionName); len(msgs) > 0 {
+		errs.add(payload.FunctionName, "functionName", "Member must satisfy DNS-1123 label: "+strings.Join(msgs, ", "))
+	}
+	if payload.PackageType != "" && payload.PackageType != "Zip" {
+		errs.add(payload.PackageType, "packageType", "Member must satisfy enum value set: [Zip]")
+	}
+	if payload.Runtime == "" {
+		errs.add(payload.Runtime, "runtime", "Member must not be null")
+	}
+	if payload.Handler == "" {
+		errs.add(payload.Handler, "handler", "Member must not be null")
+	}
+	validateArchitectures(&errs, payload.Architectures)
+	validateFunctionRequest(&errs, &payload.FunctionRequest, runtimes)
+	validateCodeSource(&errs, "code.", hasZip, payload.Code["S3Bucket"], payload.Code["S3Key"], payload.Code["S3ObjectVersion"], payload.Code["ImageUri"])
+	return errs
+}
+
+func validateUpdateFunctionConfiguration(payload *apis.UpdateFunctionConfigurationRequest, runtimes runtimeSet) validationErrors {
+	var errs validationErrors
+	validateFunctionRequest(&errs, &payload.FunctionRequest, runtimes)
+	return errs
+}
+
+func validateUpdateFunctionCode(payload *apis.UpdateFunctionCodeRequest, hasZip bool) validationErrors {
+	var errs validationErrors
+	validateArchitectures(&errs, payload.Architectures)
+	validateCodeSource(&errs, "", hasZip, payload.S3Bucket, payload.S3Key, payload.S3ObjectVersion, payload.ImageUri)
+	return errs
+}
+
+// validateFunctionRequest checks configuration fields, zero values are unset
+func validateFunctionRequest(errs *validationErrors, req *apis.FunctionRequest, runtimes runtimeSet) {
+	if req.Timeout != 0 && (req.Timeout < minTimeout || req.Timeout > maxTimeout) {
+		errs.add(req.Timeout, "timeout", fmt.Sprintf("Member must have value between %d and %d", minTimeout, maxTimeout))
+	}
+	if req.MemorySize != 0 && (req.MemorySize < minMemorySize || req.MemorySize > maxMemorySize) {
+		errs.add(req.MemorySize, "memorySize", fmt.Sprintf("Member must have value between %d and %d", minMemorySize, maxMemorySize))
+	}
+	if len(req.Description) > maxDescription {
+		errs.add(req.Description, "description", fmt.Sprintf("Member must have length less than or equal to %d", maxDescription))
+	}
+	if req.Handler != "" {
+		if len(req.Handler) > maxHandler {
+			errs.add(req.Handler, "handler", fmt.Sprintf("Member must have length less than or equal to %d", maxHandler))
+		} else if !handlerPattern.MatchString(req.Handler) {
+			errs.add(req.Handler, "handler", "Member must satisfy regular expression pattern: "+handlerPattern.String())
+		}
+	}
+	if req.Runtime != "" && !runtimes.has(req.Runtime) {
+		errs.add(req.Runtime, "runtime", "Member must satisfy enum value set: ["+strings.Join(runtimes, ", ")+"]")
+	}
+	size := 0
+	for k, v := range req.Environment.Variables {
+		size += len(k) + len(v)
+		if !envKeyPattern.MatchString(k) {
+			errs.add(k, "environment.variables", "Member key must satisfy regular expression pattern: "+envKeyPattern.String())
+		} else if _, ok := reservedEnvKeys[k]; ok || strings.HasPrefix(k, reservedEnvPrefix) {
+			errs.add(k, "environment.variables", "Member key must not be a reserved environment variable")
+		}
+	}
+	if size > maxEnvironment {
+		errs.add(size, "environment.variables", fmt.Sprintf("Member must have total size less than or equal to %d bytes", maxEnvironment))
+	}
+}
+
+func validateArchitectures(errs *validationErrors, archs []string) {
+	if len(archs) > maxArchitectures {
+		errs.add(archs, "architectures", fmt.Sprintf("Member must have length less than or equal to %d", maxArchitectures))
+	}
+	for _, arch := range archs {
+		if _, ok := architectures[arch]; !ok {
+			errs.add(archs, "architectures", "Member must satisfy enum value set: [x86_64, arm64]")
+		}
+	}
+}
+
+// validateCodeSource checks exactly one code source is given
+func validateCodeSource(errs *validationErrors, prefix string, hasZip bool, bucket, key, version, imageUri string) {
+	if imageUri != "" {
+		errs.add(imageUri, prefix+"imageUri", "Member must be null, container images are not supported")
+	}
+	hasS3 := bucket != "" || key != ""
+	if hasZip && hasS3 {
+		errs.add(bucket, prefix+"s3Bucket", "Member must be null when zipFile is given")
+	}
+	if !hasZip && !hasS3 && imageUri == "" {
+		errs.add("null", prefix+"zipFile", "Member must not be null when no s3Bucket and s3Key is given")
+	}
+	if hasS3 {
+		if len(bucket) < 3 || len(bucket) > maxS3Bucket || !s3BucketPattern.MatchString(bucket) {
+			errs.add(bucket, prefix+"s3Bucket", fmt.Sprintf("Member must have length between 3 and %d and satisfy regular expression pattern: %s", maxS3Bucket, s3BucketPattern.String()))
+		}
+		if len(key) == 0 || len(key) > maxS3Key {
+			errs.add(key, prefix+"s3Key", fmt.Sprintf("Member must have length between 1 and %d", maxS3Key))
+		}
+	}
+	if len(version) > maxS3ObjectVersion {
+		errs.add(version, prefix+"s3ObjectVersion", fmt.Sprintf("Member must have length less than or equal to %d", maxS3ObjectVersion))
+	}
+}
@@ -0,0 +1,145 @@
+package functions
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/aws-api-gw/pkg/services"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	rfclientset "github.com/refunc/refunc/pkg/generated/clientset/versioned"
+	rflister "github.com/refunc/refunc/pkg/generated/listers/refunc/v1beta3"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// nextVersion bumps latest version counter of funcdef, returns the reserved version
+func nextVersion(fndef *rfv1beta3.Funcdef) string {
+	latest, _ := strconv.Atoi(fndef.Annotations[controllers.LambdaAnnotationLatestVersion])
+	version := strconv.Itoa(latest + 1)
+	if fndef.Annotations == nil {
+		fndef.Annotations = map[string]string{}
+	}
+	fndef.Annotations[controllers.LambdaAnnotationLatestVersion] = version
+	return version
+}
+
+// publishVersion creates an immutable funcdef snapshot of given funcdef as version
+func publishVersion(refuncClient rfclientset.Interface, fndef *rfv1beta3.Funcdef, version string) (*rfv1beta3.Funcdef, error) {
+	spec := fndef.Spec.DeepCopy()
+	annotations := map[string]string{}
+	if concurrency, ok := fndef.Annotations[rfv1beta3.AnnotationLambdaConcurrency]; ok {
+		annotations[rfv1beta3.AnnotationLambdaConcurrency] = concurrency
+	}
+	return refuncClient.RefuncV1beta3().Funcdeves(fndef.Namespace).Create(context.TODO(), &rfv1beta3.Funcdef{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rfv1beta3.APIVersion,
+			Kind:       rfv1beta3.FuncdefKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      controllers.VersionFuncdefName(fndef.Name, version),
+			Namespace: fndef.Namespace,
+			Labels: map[string]string{
+				rfv1beta3.LabelLambdaName:        fndef.Name,
+				rfv1beta3.LabelLambdaVersion:     version,
+				controllers.LambdaLabelVersionOf: fndef.Name,
+			},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: rfv1beta3.APIVersion,
+					Kind:       rfv1beta3.FuncdefKind,
+					Name:       fndef.Name,
+					UID:        fndef.UID,
+				},
+			},
+		},
+		Spec: *spec,
+	}, metav1.CreateOptions{})
+}
+
+// publishCode moves function to code and publishes it as the next version. The version is reserved by creating
+// its snapshot first, and the snapshot is removed if function can't be updated after, so a failed publish
+// leaves function and its versions unchanged. revisionId works the same as controllers.UpdateFuncdef.
+func publishCode(refuncClient rfclientset.Interface, ns, name, revisionId string, code services.FunctionCode) (latest, published *rfv1beta3.Funcdef, originBody string, err error) {
+	funcdeves := refuncClient.RefuncV1beta3().Funcdeves(ns)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		fndef, err := funcdeves.Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if revisionId != "" && revisionId != fndef.ResourceVersion {
+			return controllers.ErrPreconditionFailed
+		}
+		originBody = fndef.Spec.Body
+		if err := controllers.SetFuncdefCode(fndef, code); err != nil {
+			return err
+		}
+		version := nextVersion(fndef)
+
+		published, err = publishVersion(refuncClient, fndef, version)
+		if k8serrors.IsAlreadyExists(err) {
+			// raced with another publish, retry with a fresh counter
+			return k8serrors.NewConflict(rfv1beta3.Resource("funcdef"), name, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		// update exactly the revision snapshot was taken from
+		latest, err = funcdeves.Update(context.TODO(), fndef, metav1.UpdateOptions{})
+		if err != nil {
+			if delErr := funcdeves.Delete(context.TODO(), published.Name, metav1.DeleteOptions{}); delErr != nil && !k8serrors.IsNotFound(delErr) {
+				klog.Errorf("rollback funcdef version %s/%s error %v", ns, published.Name, delErr)
+			}
+			if k8serrors.IsConflict(err) && revisionId != "" {
+				return controllers.ErrPreconditionFailed
+			}
+		}
+		return err
+	})
+	return
+}
+
+// codeInUse checks if any published version of function still references body
+func codeInUse(funcdefLister rflister.FuncdefLister, ns, name, body string) (bool, error) {
+	versions, err := funcdefLister.Funcdeves(ns).List(labels.SelectorFromSet(labels.Set{
+		controllers.LambdaLabelVersionOf: name,
+	}))
+	if err != nil {
+		return false, err
+	}
+	for _, version := range versions {
+		if version.Spec.Body == body {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getQualifiedFuncdef gets funcdef of function name at qualifier, a not found error is returned for aliases
+func getQualifiedFuncdef(refuncClient rfclientset.Interface, ns, name, qualifier string) (*rfv1beta3.Funcdef, error) {
+	fndefName, ok := controllers.QualifiedFuncdefName(name, qualifier)
+	if !ok {
+		return nil, k8serrors.NewNotFound(rfv1beta3.Resource("funcdef"), qualifiedName(name, qualifier))
+	}
+	fndef, err := refuncClient.RefuncV1beta3().Funcdeves(ns).Get(context.TODO(), fndefName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !controllers.IsFuncdefOf(fndef, name) {
+		return nil, k8serrors.NewNotFound(rfv1beta3.Resource("funcdef"), qualifiedName(name, qualifier))
+	}
+	return fndef, nil
+}
+
+// qualifiedName formats name:qualifier the aws way
+func qualifiedName(name, qualifier string) string {
+	if qualifier == "" {
+		return name
+	}
+	return name + ":" + qualifier
+}
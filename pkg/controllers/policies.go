@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LambdaAnnotationPolicy on a service account holds an iam identity policy document of it,
+// ConfigMaps labelled LambdaLabelServiceAccount hold more, one document per data key
+const LambdaAnnotationPolicy = "lambda.refunc.io/policy"
+
+// Policies loads identity policies bound to service accounts
+type Policies struct {
+	serviceAccounts corelisters.ServiceAccountLister
+	configMaps      corelisters.ConfigMapLister
+	HasSynced       cache.InformerSynced
+}
+
+// NewPolicies requests informers of service accounts and config maps, it must be called before informers start
+func NewPolicies(sc sharedcfg.Configs) *Policies {
+	saInformer := sc.KubeInformers().Core().V1().ServiceAccounts()
+	cmInformer := sc.KubeInformers().Core().V1().ConfigMaps()
+	return &Policies{
+		serviceAccounts: saInformer.Lister(),
+		configMaps:      cmInformer.Lister(),
+		HasSynced: func() bool {
+			return saInformer.Informer().HasSynced() && cmInformer.Informer().HasSynced()
+		},
+	}
+}
+
+// PoliciesOf returns policies of service account, any invalid document is an error
+// so that a deny is never silently dropped
+func (p *Policies) PoliciesOf(ns, serviceAccount string) ([]*awsutils.PolicyDocument, error) {
+	var docs []*awsutils.PolicyDocument
+	sa, err := p.serviceAccounts.ServiceAccounts(ns).Get(serviceAccount)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		if data, ok := sa.Annotations[LambdaAnnotationPolicy]; ok {
+			doc, err := awsutils.ParsePolicyDocument([]byte(data))
+			if err != nil {
+				return nil, fmt.Errorf("policy of serviceaccount %s/%s: %v", ns, serviceAccount, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	cms, err := p.configMaps.ConfigMaps(ns).List(labels.SelectorFromSet(labels.Set{LambdaLabelServiceAccount: serviceAccount}))
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range cms {
+		for key, data := range cm.Data {
+			doc, err := awsutils.ParsePolicyDocument([]byte(data))
+			if err != nil {
+				return nil, fmt.Errorf("policy %s of configmap %s/%s: %v", key, ns, cm.Name, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+)
+
+// ResolveFunctionName resolves a function name, partial arn or arn in scope of the authenticated caller,
+// the Qualifier query is merged into the returned qualifier. An error response is written if not ok.
+func ResolveFunctionName(c *gin.Context, raw string) (string, string, bool) {
+	fn, err := awsutils.ParseFunctionName(raw)
+	if err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("%v", err))
+		return "", "", false
+	}
+	if region := c.GetString("awsRegion"); fn.Region != "" && fn.Region != region {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("Region %s of function %s does not match the request region %s", fn.Region, raw, region))
+		return "", "", false
+	}
+	if account := c.GetString("accountID"); fn.Account != "" && account != "" && fn.Account != account {
+		awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("Function %s is not owned by account %s", raw, account))
+		return "", "", false
+	}
+	if qualifier := c.Query("Qualifier"); qualifier != "" {
+		if fn.Qualifier != "" && fn.Qualifier != qualifier {
+			awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("The derived qualifier from the function name does not match the specified qualifier."))
+			return "", "", false
+		}
+		fn.Qualifier = qualifier
+	}
+	return fn.Name, fn.Qualifier, true
+}
+
+// ResolveUnqualifiedFunctionName resolves function name like ResolveFunctionName for apis which take no qualifier
+func ResolveUnqualifiedFunctionName(c *gin.Context, raw string) (string, bool) {
+	name, qualifier, ok := ResolveFunctionName(c, raw)
+	if ok && !IsLatest(qualifier) {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidParameterValue.WithMessage("Qualifier %s is not supported by this operation", qualifier))
+		return "", false
+	}
+	return name, ok
+}
+
+// IsLatest reports if qualifier refers to the unpublished function
+func IsLatest(qualifier string) bool {
+	return qualifier == "" || qualifier == "$LATEST"
+}
+
+// QualifiedFuncdefName returns funcdef name of a qualified function, aliases are not supported
+func QualifiedFuncdefName(name, qualifier string) (string, bool) {
+	if IsLatest(qualifier) {
+		return name, true
+	}
+	if _, err := strconv.Atoi(qualifier); err == nil {
+		return VersionFuncdefName(name, qualifier), true
+	}
+	return "", false
+}
+
+// IsFuncdefOf reports if fndef is the function name or one of its versions
+func IsFuncdefOf(fndef *rfv1beta3.Funcdef, name string) bool {
+	if versionOf, ok := fndef.Labels[LambdaLabelVersionOf]; ok {
+		return versionOf == name
+	}
+	return fndef.Name == name
+}
+
+// CallerIdentity returns the authenticated service account, qualified as `<namespace>:<name>`
+// when it acts in a namespace other than its own, `:` never appears in names
+func CallerIdentity(c *gin.Context) string {
+	identity := c.GetString("accessKeyID")
+	if home := c.GetString("principalNamespace"); home != "" && home != c.GetString("region") {
+		return home + ":" + identity
+	}
+	return identity
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	rfclientset "github.com/refunc/refunc/pkg/generated/clientset/versioned"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// ErrPreconditionFailed indicates the RevisionId given by caller is stale
+var ErrPreconditionFailed = errors.New("the revision id provided does not match the latest revision id")
+
+// UpdateFuncdef applies mutate to the latest funcdef and updates it.
+// A non-empty revisionId pins the update to that ResourceVersion, otherwise conflicts are retried.
+func UpdateFuncdef(rc rfclientset.Interface, ns, name, revisionId string, mutate func(fndef *rfv1beta3.Funcdef) error) (*rfv1beta3.Funcdef, error) {
+	var updated *rfv1beta3.Funcdef
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		fndef, err := rc.RefuncV1beta3().Funcdeves(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if revisionId != "" && revisionId != fndef.ResourceVersion {
+			return ErrPreconditionFailed
+		}
+		if err := mutate(fndef); err != nil {
+			return err
+		}
+		updated, err = rc.RefuncV1beta3().Funcdeves(ns).Update(context.TODO(), fndef, metav1.UpdateOptions{})
+		if k8serrors.IsConflict(err) && revisionId != "" {
+			return ErrPreconditionFailed
+		}
+		return err
+	})
+	return updated, err
+}
+
+// UpdateTrigger applies mutate to the latest trigger and updates it,
+// revisionId works the same as UpdateFuncdef.
+func UpdateTrigger(rc rfclientset.Interface, ns, name, revisionId string, mutate func(trigger *rfv1beta3.Trigger) error) (*rfv1beta3.Trigger, error) {
+	var updated *rfv1beta3.Trigger
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		trigger, err := rc.RefuncV1beta3().Triggers(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if revisionId != "" && revisionId != trigger.ResourceVersion {
+			return ErrPreconditionFailed
+		}
+		if err := mutate(trigger); err != nil {
+			return err
+		}
+		updated, err = rc.RefuncV1beta3().Triggers(ns).Update(context.TODO(), trigger, metav1.UpdateOptions{})
+		if k8serrors.IsConflict(err) && revisionId != "" {
+			return ErrPreconditionFailed
+		}
+		return err
+	})
+	return updated, err
+}
@@ -0,0 +1,220 @@
+package s3proxy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	awsSigner "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/refunc/pkg/env"
+)
+
+const (
+	// PathPrefix is where the s3 api is served
+	PathPrefix = "/s3"
+	// minioRegion is the region upstream requests are signed for
+	minioRegion = "us-east-1"
+)
+
+// headers of client request which are not forwarded, upstream request is signed again
+var dropHeaders = map[string]struct{}{
+	"Authorization":        {},
+	"X-Amz-Date":           {},
+	"X-Amz-Security-Token": {},
+	"Connection":           {},
+	"Keep-Alive":           {},
+	"Proxy-Authorization":  {},
+	"Te":                   {},
+	"Trailer":              {},
+	"Transfer-Encoding":    {},
+	"Upgrade":              {},
+}
+
+// listQueryKeys are parameters of ListObjects and ListObjectsV2, other bucket level queries are subresources
+var listQueryKeys = map[string]struct{}{
+	"prefix":             {},
+	"delimiter":          {},
+	"encoding-type":      {},
+	"max-keys":           {},
+	"marker":             {},
+	"list-type":          {},
+	"continuation-token": {},
+	"start-after":        {},
+	"fetch-owner":        {},
+}
+
+var proxyClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	},
+	// bounds a whole transfer, big enough for objects the gateway handles
+	Timeout: 30 * time.Minute,
+	// redirects are answered to client as is
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// NamespacePrefix is the key prefix in refunc bucket a namespace is allowed to access through proxy
+func NamespacePrefix(ns string) string {
+	return strings.TrimPrefix(fmt.Sprintf("%s/s3/%s/", env.GlobalScopeRoot, ns), "/")
+}
+
+// Proxy forwards s3 api request to refunc minio, re-signed with minio credentials
+func Proxy(c *gin.Context) {
+	region := c.GetString("region")
+	prefix := NamespacePrefix(region)
+
+	bucket, key := splitPath(c.Param("path"))
+	if bucket != env.GlobalBucket {
+		s3ErrorResponse(c, 403, "AccessDenied", fmt.Sprintf("only bucket %s is accessible", env.GlobalBucket))
+		return
+	}
+	if key == "" {
+		// bucket level, only plain listing within namespace prefix and location are allowed
+		if c.Request.Method != http.MethodGet || !(isLocation(c.Request.URL.Query()) || isListing(c.Request.URL.Query(), prefix)) {
+			s3ErrorResponse(c, 403, "AccessDenied", fmt.Sprintf("only objects under %s are accessible", prefix))
+			return
+		}
+	} else if !keyWithin(key, prefix) {
+		s3ErrorResponse(c, 403, "AccessDenied", fmt.Sprintf("only objects under %s are accessible", prefix))
+		return
+	}
+	if source := c.Request.Header.Get("X-Amz-Copy-Source"); source != "" {
+		source, err := url.PathUnescape(strings.SplitN(source, "?", 2)[0])
+		if err != nil {
+			s3ErrorResponse(c, 400, "InvalidArgument", "invalid copy source")
+			return
+		}
+		if srcBucket, srcKey := splitPath(source); srcBucket != env.GlobalBucket || !keyWithin(srcKey, prefix) {
+			s3ErrorResponse(c, 403, "AccessDenied", fmt.Sprintf("only objects under %s are accessible", prefix))
+			return
+		}
+	}
+	if strings.HasPrefix(c.Request.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		// chunk signatures chain from client signature, they can't be re-signed
+		s3ErrorResponse(c, 501, "NotImplemented", "streaming signed payload is not supported, use a signed or unsigned payload")
+		return
+	}
+
+	upstream, err := url.Parse(env.GlobalMinioEndpoint)
+	if err != nil {
+		utils.Log(c).Errorf("parse minio endpoint error %v", err)
+		s3ErrorResponse(c, 500, "InternalError", "invalid upstream")
+		return
+	}
+	upstream.Path = "/" + bucket
+	if key != "" {
+		upstream.Path += "/" + key
+	}
+	upstream.RawQuery = c.Request.URL.RawQuery
+
+	var body io.Reader = http.NoBody
+	if c.Request.ContentLength != 0 {
+		body = c.Request.Body
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, upstream.String(), body)
+	if err != nil {
+		utils.Log(c).Errorf("create upstream request error %v", err)
+		s3ErrorResponse(c, 500, "InternalError", "invalid upstream request")
+		return
+	}
+	req.ContentLength = c.Request.ContentLength
+	for k, vs := range c.Request.Header {
+		if _, ok := dropHeaders[k]; ok {
+			continue
+		}
+		req.Header[k] = vs
+	}
+
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	}
+	// payload hash header of client is reused, body is never read here
+	signer := awsSigner.NewSigner(awsCredentials.NewStaticCredentials(env.GlobalAccessKey, env.GlobalSecretKey, ""))
+	signer.DisableURIPathEscaping = true
+	if _, err := signer.Sign(req, nil, "s3", minioRegion, time.Now()); err != nil {
+		utils.Log(c).Errorf("sign upstream request error %v", err)
+		s3ErrorResponse(c, 500, "InternalError", "sign upstream request error")
+		return
+	}
+
+	res, err := proxyClient.Do(req)
+	if err != nil {
+		utils.Log(c).Errorf("proxy s3 request error %v", err)
+		s3ErrorResponse(c, 502, "InternalError", "upstream unavailable")
+		return
+	}
+	defer res.Body.Close()
+	for k, vs := range res.Header {
+		if _, ok := dropHeaders[k]; ok {
+			continue
+		}
+		c.Writer.Header()[k] = vs
+	}
+	c.Status(res.StatusCode)
+	if _, err := io.Copy(c.Writer, res.Body); err != nil {
+		utils.Log(c).Errorf("copy s3 response error %v", err)
+	}
+}
+
+// keyWithin reports if key is under prefix, keys with . or .. segments are never, upstream may resolve them
+func keyWithin(key, prefix string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return strings.HasPrefix(key, prefix) && strings.HasPrefix(path.Clean(key)+"/", prefix)
+}
+
+// isLocation reports if bucket level query is GetBucketLocation
+func isLocation(query url.Values) bool {
+	_, ok := query["location"]
+	return ok && len(query) == 1
+}
+
+// isListing reports if bucket level query is ListObjects within prefix, without any subresource
+func isListing(query url.Values, prefix string) bool {
+	for k := range query {
+		if _, ok := listQueryKeys[k]; !ok {
+			return false
+		}
+	}
+	p := query.Get("prefix")
+	return strings.HasPrefix(p, prefix) && !strings.Contains(p, "..")
+}
+
+// splitPath splits /bucket/key into bucket and key
+func splitPath(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// s3ErrorResponse writes error the s3 way, in xml
+func s3ErrorResponse(c *gin.Context, status int, code, msg string) {
+	c.XML(status, s3Error{Code: code, Message: msg})
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/refunc/aws-api-gw/pkg/apis"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	rflister "github.com/refunc/refunc/pkg/generated/listers/refunc/v1beta3"
+	"github.com/refunc/refunc/pkg/utils/rfutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	StatePending = "Pending"
+	StateActive  = "Active"
+	StateFailed  = "Failed"
+
+	LastUpdateStatusInProgress = "InProgress"
+	LastUpdateStatusSuccessful = "Successful"
+	LastUpdateStatusFailed     = "Failed"
+
+	StateReasonCodeCreating       = "Creating"
+	StateReasonCodeInvalidRuntime = "InvalidRuntime"
+	StateReasonCodeInternalError  = "InternalError"
+)
+
+// funcinstReasonUnsupportedXRT is the reason refunc marks funcinst pending with when its runtime can't be run,
+// other pending reasons like XenvNotResolved are transient
+const funcinstReasonUnsupportedXRT = "UnsupportXRT"
+
+// SetLambdaState derives lambda's State and LastUpdateStatus from funcdef and its funcinsts,
+// funcdef without any living funcinst is treated as active since refunc starts workers on demand.
+func SetLambdaState(cfg *apis.FunctionConfiguration, fndef *rfv1beta3.Funcdef, xenvLister rflister.XenvLister, funcinstLister rflister.FuncinstLister) error {
+	cfg.State, cfg.StateReason, cfg.StateReasonCode = StateActive, "", ""
+	cfg.LastUpdateStatus, cfg.LastUpdateStatusReason, cfg.LastUpdateStatusReasonCode = LastUpdateStatusSuccessful, "", ""
+
+	// creating is the first generation of funcdef, later generations are updates
+	creating := fndef.Generation <= 1
+
+	setFailed := func(code, reason string) {
+		cfg.LastUpdateStatus, cfg.LastUpdateStatusReason, cfg.LastUpdateStatusReasonCode = LastUpdateStatusFailed, reason, code
+		if creating {
+			cfg.State, cfg.StateReason, cfg.StateReasonCode = StateFailed, reason, code
+		}
+	}
+
+	if fndef.Spec.Runtime == nil {
+		setFailed(StateReasonCodeInvalidRuntime, "The function runtime is not set.")
+		return nil
+	}
+	if _, err := xenvLister.Xenvs(fndef.Namespace).Get(fndef.Spec.Runtime.Name); err != nil {
+		if errors.IsNotFound(err) {
+			setFailed(StateReasonCodeInvalidRuntime, fmt.Sprintf("The runtime %s is not supported.", fndef.Spec.Runtime.Name))
+			return nil
+		}
+		return err
+	}
+
+	fnis, err := funcinstLister.Funcinsts(fndef.Namespace).List(labels.SelectorFromSet(labels.Set{
+		rfv1beta3.LabelName: fndef.Name,
+	}))
+	if err != nil {
+		return err
+	}
+
+	hash, specHash := rfutil.GetHash(fndef), rfutil.GetSpecHash(fndef)
+	var retiring, starting, active bool
+	for _, fni := range fnis {
+		if fni.Status.IsInactiveCondition() {
+			continue
+		}
+		if fni.Labels[rfv1beta3.LabelHash] != hash || fni.Labels[rfv1beta3.LabelSpecHash] != specHash {
+			// funcinst of previous revision is not retired yet
+			retiring = true
+			continue
+		}
+		if pending := pendingCondition(&fni.Status); pending != nil {
+			if pending.Reason == funcinstReasonUnsupportedXRT {
+				setFailed(StateReasonCodeInvalidRuntime, pending.Message)
+				return nil
+			}
+			starting = true
+			continue
+		}
+		if fni.Status.IsActiveCondition() {
+			active = true
+		} else {
+			starting = true
+		}
+	}
+
+	if active {
+		return nil
+	}
+	if creating && starting {
+		cfg.State, cfg.StateReason, cfg.StateReasonCode = StatePending, "The function is being created.", StateReasonCodeCreating
+		cfg.LastUpdateStatus = LastUpdateStatusInProgress
+		return nil
+	}
+	if retiring || starting {
+		cfg.LastUpdateStatus, cfg.LastUpdateStatusReason = LastUpdateStatusInProgress, "The function is being updated."
+	}
+	return nil
+}
+
+func pendingCondition(status *rfv1beta3.FuncinstStatus) *rfv1beta3.FuncinstCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == rfv1beta3.FuncinstPending && status.Conditions[i].Status == corev1.ConditionTrue {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
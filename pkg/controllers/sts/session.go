@@ -0,0 +1,127 @@
+package sts
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("sts: invalid session token")
+	ErrExpiredToken = errors.New("sts: session token expired")
+)
+
+// Session is carried by session token, temporary credentials act as Subject in Namespace
+type Session struct {
+	AccessKeyID string `json:"k"`
+	Namespace   string `json:"n"`
+	// service account the session acts as
+	Subject string `json:"s"`
+	// namespace of Subject when it is not Namespace
+	SubjectNamespace string `json:"h,omitempty"`
+	// role session name of AssumeRole, empty for GetSessionToken
+	RoleSessionName string `json:"r,omitempty"`
+	Expiration      int64  `json:"e"`
+	// long term access key the session is derived from, empty without rbac
+	Issuer *Issuer `json:"i,omitempty"`
+}
+
+// Issuer is the long term access key of a session, the session is rejected once the key is deleted or rotated
+type Issuer struct {
+	Namespace   string `json:"n"`
+	AccessKeyID string `json:"k"`
+	// Fingerprint of the secret access key
+	Fingerprint string `json:"f"`
+}
+
+// Credentials is a temporary access key, secret and session token triple
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// SessionTokens issues and verifies stateless session tokens, signed by a gateway key,
+// secret of temporary credentials is derived from token so nothing is stored
+type SessionTokens struct {
+	key []byte
+}
+
+func NewSessionTokens(key []byte) *SessionTokens {
+	return &SessionTokens{key: key}
+}
+
+// Issue mints temporary credentials of session, AccessKeyID and Expiration are filled
+func (t *SessionTokens) Issue(session Session, duration time.Duration) (*Credentials, error) {
+	nonce := make([]byte, 10)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(duration).UTC().Truncate(time.Second)
+	session.AccessKeyID = "ASIA" + base32.StdEncoding.EncodeToString(nonce)
+	session.Expiration = expiration.Unix()
+
+	bts, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(bts)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(t.mac("token", payload))
+	return &Credentials{
+		AccessKeyId:     session.AccessKeyID,
+		SecretAccessKey: t.Secret(token),
+		SessionToken:    token,
+		Expiration:      expiration,
+	}, nil
+}
+
+// Verify checks token is issued by gateway and not expired
+func (t *SessionTokens) Verify(token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, t.mac("token", parts[0])) {
+		return nil, ErrInvalidToken
+	}
+	bts, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var session Session
+	if err := json.Unmarshal(bts, &session); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= session.Expiration {
+		return nil, ErrExpiredToken
+	}
+	return &session, nil
+}
+
+// Secret derives secret access key of token
+func (t *SessionTokens) Secret(token string) string {
+	payload := token
+	if i := strings.Index(token, "."); i >= 0 {
+		payload = token[:i]
+	}
+	return base64.RawURLEncoding.EncodeToString(t.mac("secret", payload))
+}
+
+// Fingerprint identifies a secret access key without revealing it
+func (t *SessionTokens) Fingerprint(secret string) string {
+	return base64.RawURLEncoding.EncodeToString(t.mac("issuer", secret)[:12])
+}
+
+func (t *SessionTokens) mac(usage, payload string) []byte {
+	h := hmac.New(sha256.New, t.key)
+	h.Write([]byte(usage + ":" + payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,320 @@
+package sts
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// PathPrefix of sts api, use http://<gateway>/sts as sts endpoint url
+const PathPrefix = "/sts"
+
+// AnnotationTrustedIdentities of service account lists identities allowed to assume it,
+// `<namespace>/<name>` for ones of other namespaces, `*` for anyone acting in namespace
+const AnnotationTrustedIdentities = "lambda.refunc.io/assume-role-trust"
+
+const xmlns = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+// limits of sts, see https://docs.aws.amazon.com/STS/latest/APIReference/API_AssumeRole.html
+const (
+	minDuration             = 15 * time.Minute
+	maxRoleDuration         = 12 * time.Hour
+	maxChainedRoleDuration  = time.Hour
+	maxSessionTokenDuration = 36 * time.Hour
+	defaultRoleDuration     = time.Hour
+	defaultSessionDuration  = 12 * time.Hour
+)
+
+var roleSessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// Handler serves sts query api, actions are read from query or form body
+func Handler(tokens *SessionTokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch action := c.Request.FormValue("Action"); action {
+		case "AssumeRole":
+			assumeRole(c, tokens)
+		case "GetSessionToken":
+			getSessionToken(c, tokens)
+		case "GetCallerIdentity":
+			getCallerIdentity(c)
+		case "":
+			errorResponse(c, http.StatusBadRequest, "MissingAction", "Action is required.")
+		default:
+			errorResponse(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("Could not find operation %s for version 2011-06-15.", action))
+		}
+	}
+}
+
+type credentialsXML struct {
+	AccessKeyId     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+func toCredentialsXML(creds *Credentials) credentialsXML {
+	return credentialsXML{
+		AccessKeyId:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration.Format(time.RFC3339),
+	}
+}
+
+type responseMetadata struct {
+	RequestId string `xml:"RequestId"`
+}
+
+type assumeRoleResponse struct {
+	XMLName xml.Name `xml:"AssumeRoleResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Credentials     credentialsXML `xml:"Credentials"`
+		AssumedRoleUser struct {
+			Arn           string `xml:"Arn"`
+			AssumedRoleId string `xml:"AssumedRoleId"`
+		} `xml:"AssumedRoleUser"`
+	} `xml:"AssumeRoleResult"`
+	ResponseMetadata responseMetadata `xml:"ResponseMetadata"`
+}
+
+type getSessionTokenResponse struct {
+	XMLName xml.Name `xml:"GetSessionTokenResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Credentials credentialsXML `xml:"Credentials"`
+	} `xml:"GetSessionTokenResult"`
+	ResponseMetadata responseMetadata `xml:"ResponseMetadata"`
+}
+
+// assumeRole issues credentials acting as the service account named by RoleArn, arn:aws:iam::<account>:role/<name>
+func assumeRole(c *gin.Context, tokens *SessionTokens) {
+	region := c.GetString("region")
+	identity := c.GetString("accessKeyID")
+	// callers from other namespaces are trusted by `<namespace>/<name>`
+	qualified := c.GetString("principalNamespace") + "/" + identity
+
+	roleArn := c.Request.FormValue("RoleArn")
+	arn := strings.Split(roleArn, ":")
+	if len(arn) != 6 || arn[0] != "arn" || arn[2] != "iam" || !strings.HasPrefix(arn[5], "role/") {
+		errorResponse(c, http.StatusBadRequest, "ValidationError", fmt.Sprintf("%s is invalid", roleArn))
+		return
+	}
+	if arn[4] != c.GetString("accountID") {
+		errorResponse(c, http.StatusForbidden, "AccessDenied", fmt.Sprintf("User: %s is not authorized to perform: sts:AssumeRole on resource: %s", identity, roleArn))
+		return
+	}
+	role := arn[5][strings.LastIndex(arn[5], "/")+1:]
+
+	sessionName := c.Request.FormValue("RoleSessionName")
+	if !roleSessionNamePattern.MatchString(sessionName) {
+		errorResponse(c, http.StatusBadRequest, "ValidationError", "1 validation error detected: Value at 'roleSessionName' failed to satisfy constraint: Member must satisfy regular expression pattern: "+roleSessionNamePattern.String())
+		return
+	}
+
+	maxDuration := maxRoleDuration
+	if _, chained := c.Get("session"); chained {
+		maxDuration = maxChainedRoleDuration
+	}
+	duration, ok := durationSeconds(c, defaultRoleDuration, maxDuration)
+	if !ok {
+		return
+	}
+
+	saLister, err := utils.GetServiceAccountLister(c)
+	if err != nil {
+		utils.Log(c).Error(err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	sa, err := saLister.ServiceAccounts(region).Get(role)
+	if err != nil && !errors.IsNotFound(err) {
+		utils.Log(c).Errorf("get service account %s/%s error %v", region, role, err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	trusted := false
+	if err == nil {
+		local := qualified == region+"/"+identity
+		trusted = local && role == identity
+		for _, id := range strings.Split(sa.Annotations[AnnotationTrustedIdentities], ",") {
+			id = strings.TrimSpace(id)
+			trusted = trusted || id == "*" || id == qualified || (local && id == identity)
+		}
+	}
+	if !trusted {
+		errorResponse(c, http.StatusForbidden, "AccessDenied", fmt.Sprintf("User: %s is not authorized to perform: sts:AssumeRole on resource: %s", identity, roleArn))
+		return
+	}
+
+	creds, err := tokens.Issue(Session{Namespace: region, Subject: role, RoleSessionName: sessionName, Issuer: callerIssuer(c)}, duration)
+	if err != nil {
+		utils.Log(c).Errorf("issue session token error %v", err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	utils.Log(c).Infof("%s assumed role %s/%s as %s", identity, region, role, creds.AccessKeyId)
+
+	var resp assumeRoleResponse
+	resp.Xmlns = xmlns
+	resp.Result.Credentials = toCredentialsXML(creds)
+	resp.Result.AssumedRoleUser.Arn = awsutils.AssumedRoleArn(arn[4], role, sessionName)
+	resp.Result.AssumedRoleUser.AssumedRoleId = principalID(roleIDPrefix, string(sa.UID)) + ":" + sessionName
+	resp.ResponseMetadata.RequestId = utils.GetRequestID(c)
+	c.XML(http.StatusOK, resp)
+}
+
+// callerIssuer is the long term access key behind caller, sessions derived from a session keep its issuer
+func callerIssuer(c *gin.Context) *Issuer {
+	if issuer, ok := c.Get("issuer"); ok {
+		return issuer.(*Issuer)
+	}
+	return nil
+}
+
+// getSessionToken issues credentials acting as the caller itself
+func getSessionToken(c *gin.Context, tokens *SessionTokens) {
+	if _, ok := c.Get("session"); ok {
+		errorResponse(c, http.StatusForbidden, "AccessDenied", "Cannot call GetSessionToken with session credentials")
+		return
+	}
+	duration, ok := durationSeconds(c, defaultSessionDuration, maxSessionTokenDuration)
+	if !ok {
+		return
+	}
+
+	session := Session{Namespace: c.GetString("region"), Subject: c.GetString("accessKeyID"), Issuer: callerIssuer(c)}
+	if home := c.GetString("principalNamespace"); home != session.Namespace {
+		session.SubjectNamespace = home
+	}
+	creds, err := tokens.Issue(session, duration)
+	if err != nil {
+		utils.Log(c).Errorf("issue session token error %v", err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	utils.Log(c).Infof("%s got session token %s", c.GetString("accessKeyID"), creds.AccessKeyId)
+
+	var resp getSessionTokenResponse
+	resp.Xmlns = xmlns
+	resp.Result.Credentials = toCredentialsXML(creds)
+	resp.ResponseMetadata.RequestId = utils.GetRequestID(c)
+	c.XML(http.StatusOK, resp)
+}
+
+type getCallerIdentityResponse struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Result  struct {
+		Arn     string `xml:"Arn"`
+		UserId  string `xml:"UserId"`
+		Account string `xml:"Account"`
+	} `xml:"GetCallerIdentityResult"`
+	ResponseMetadata responseMetadata `xml:"ResponseMetadata"`
+}
+
+// getCallerIdentity answers who the signing credential is, a service account user or an assumed role session
+func getCallerIdentity(c *gin.Context) {
+	account := c.GetString("accountID")
+	identity := c.GetString("accessKeyID")
+	ns := c.GetString("principalNamespace")
+
+	saLister, err := utils.GetServiceAccountLister(c)
+	if err != nil {
+		utils.Log(c).Error(err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	sa, err := saLister.ServiceAccounts(ns).Get(identity)
+	if err != nil && !errors.IsNotFound(err) {
+		utils.Log(c).Errorf("get service account %s/%s error %v", ns, identity, err)
+		errorResponse(c, http.StatusInternalServerError, "InternalFailure", "The request processing has failed because of an unknown error.")
+		return
+	}
+	// without rbac the caller may not be a service account, its id is derived from name
+	uid := ns + "/" + identity
+	if err == nil {
+		uid = string(sa.UID)
+	}
+
+	var resp getCallerIdentityResponse
+	resp.Xmlns = xmlns
+	resp.Result.Account = account
+	resp.Result.Arn = awsutils.UserArn(account, identity)
+	resp.Result.UserId = principalID(userIDPrefix, uid)
+	if session, ok := c.Get("session"); ok && session.(*Session).RoleSessionName != "" {
+		sessionName := session.(*Session).RoleSessionName
+		resp.Result.Arn = awsutils.AssumedRoleArn(account, identity, sessionName)
+		resp.Result.UserId = principalID(roleIDPrefix, uid) + ":" + sessionName
+	}
+	resp.ResponseMetadata.RequestId = utils.GetRequestID(c)
+	c.XML(http.StatusOK, resp)
+}
+
+// prefixes of unique ids of aws iam users and roles
+const (
+	userIDPrefix = "AIDA"
+	roleIDPrefix = "AROA"
+)
+
+// principalID is the stable unique id of a service account shaped as aws ones, derived from its uid
+// so a service account re-created with the same name gets a new one
+func principalID(prefix, uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return prefix + base32.StdEncoding.EncodeToString(sum[:])[:17]
+}
+
+// durationSeconds reads DurationSeconds, answers ValidationError if it's out of range
+func durationSeconds(c *gin.Context, defaultDuration, maxDuration time.Duration) (time.Duration, bool) {
+	value := c.Request.FormValue("DurationSeconds")
+	if value == "" {
+		if defaultDuration > maxDuration {
+			return maxDuration, true
+		}
+		return defaultDuration, true
+	}
+	seconds, err := strconv.Atoi(value)
+	if duration := time.Duration(seconds) * time.Second; err == nil && duration >= minDuration && duration <= maxDuration {
+		return duration, true
+	}
+	errorResponse(c, http.StatusBadRequest, "ValidationError", fmt.Sprintf("1 validation error detected: Value '%s' at 'durationSeconds' failed to satisfy constraint: Member must have value between %d and %d",
+		value, int(minDuration.Seconds()), int(maxDuration.Seconds())))
+	return 0, false
+}
+
+type errorResponseXML struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Error   struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+	RequestId string `xml:"RequestId"`
+}
+
+// errorResponse answers error the sts query way, in xml
+func errorResponse(c *gin.Context, status int, code, msg string) {
+	var resp errorResponseXML
+	resp.Xmlns = xmlns
+	resp.Error.Type = "Sender"
+	if status >= 500 {
+		resp.Error.Type = "Receiver"
+	}
+	resp.Error.Code = code
+	resp.Error.Message = msg
+	resp.RequestId = utils.GetRequestID(c)
+	utils.Log(c).Infof("%s %s answered %d %s: %s", c.Request.Method, c.Request.URL.Path, status, code, msg)
+	c.XML(status, resp)
+}
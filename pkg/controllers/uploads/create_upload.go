@@ -0,0 +1,35 @@
+package uploads
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/apis"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/aws-api-gw/pkg/services"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+)
+
+// CreateCodeUpload issues a presigned PUT url of a staging key owned by caller,
+// the key is then used as S3Bucket/S3Key of CreateFunction or UpdateFunctionCode.
+func CreateCodeUpload(c *gin.Context) {
+	region := c.GetString("region")
+	owner := controllers.CallerIdentity(c)
+
+	upload, err := services.NewStagingUpload(region, owner)
+	if err != nil {
+		utils.Log(c).Errorf("presign code upload error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		return
+	}
+
+	c.JSON(http.StatusCreated, apis.CodeUploadConfig{
+		UploadUrl:  upload.URL,
+		Method:     http.MethodPut,
+		S3Bucket:   upload.Bucket,
+		S3Key:      upload.Key,
+		Expiration: upload.Expiration.UTC().Format(time.RFC3339),
+	})
+}
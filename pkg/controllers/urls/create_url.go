@@ -14,33 +14,35 @@ import (
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func CreateURL(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	triggerName := fmt.Sprintf("lambda-http-%s", functionName)
 	var payload apis.FunctionURLConfig
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidRequestContent.WithMessage("%v", err))
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	region := c.GetString("region")
 
 	funcdef, err := refuncClient.RefuncV1beta3().Funcdeves(region).Get(context.TODO(), functionName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get funcdef error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get funcdef error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound.WithMessage("Function not found: %s", functionName))
 		return
 	}
 
@@ -77,19 +79,19 @@ func CreateURL(c *gin.Context) {
 		},
 	}, metav1.CreateOptions{})
 	if err != nil {
-		klog.Errorf("create trigger error %v", err)
+		utils.Log(c).Errorf("create trigger error %v", err)
 		if strings.Contains(err.Error(), "exists") {
-			awsutils.AWSErrorResponse(c, 409, "ResourceConflictException")
+			awsutils.ErrorResponse(c, awsutils.ErrResourceConflict)
 		} else {
-			awsutils.AWSErrorResponse(c, 500, "ServiceException")
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		}
 		return
 	}
 
-	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger)
+	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("httptrigger to lambda url config error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("httptrigger to lambda url config error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -12,36 +12,38 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func GetURL(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	triggerName := fmt.Sprintf("lambda-http-%s", functionName)
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	trigger, err := refuncClient.RefuncV1beta3().Triggers(region).Get(context.TODO(), triggerName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get httptrigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get httptrigger error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
-	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger)
+	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("httptrigger to lambda url config error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("httptrigger to lambda url config error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -49,32 +51,35 @@ func GetURL(c *gin.Context) {
 }
 
 func ListURL(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	triggerName := fmt.Sprintf("lambda-http-%s", functionName)
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	region := c.GetString("region")
 	trigger, err := refuncClient.RefuncV1beta3().Triggers(region).Get(context.TODO(), triggerName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get httptrigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("get httptrigger error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
 	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
+		awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
 		return
 	}
 
-	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger)
+	urlConfig, err := controllers.HTTPtriggerToURLConfig(*trigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("httptrigger to lambda url config error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("httptrigger to lambda url config error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
@@ -1,7 +1,6 @@
 package urls
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 
@@ -12,55 +11,52 @@ import (
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
 	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog/v2"
 )
 
 func UpdateURL(c *gin.Context) {
-	functionName := c.Param("FunctionName")
+	functionName, ok := controllers.ResolveUnqualifiedFunctionName(c, c.Param("FunctionName"))
+	if !ok {
+		return
+	}
 	triggerName := fmt.Sprintf("lambda-http-%s", functionName)
 	var payload apis.FunctionURLConfig
-	if err := c.BindJSON(&payload); err != nil {
-		awsutils.AWSErrorResponse(c, 400, "InvalidParameterValueException")
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidRequestContent.WithMessage("%v", err))
 		return
 	}
 
 	refuncClient, err := utils.GetRefuncClient(c)
 	if err != nil {
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 	region := c.GetString("region")
 
-	currentTrigger, err := refuncClient.RefuncV1beta3().Triggers(region).Get(context.TODO(), triggerName, metav1.GetOptions{})
-	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf("get current trigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
-		return
-	}
-	if errors.IsNotFound(err) {
-		awsutils.AWSErrorResponse(c, 404, "ResourceNotFoundException")
-		return
-	}
-
-	currentTrigger.Spec.TriggerConfig = rfv1beta3.TriggerConfig{
-		HTTP: &rfv1beta3.HTTPTrigger{
-			AuthType: "None",
-			Cors:     rfv1beta3.HTTPTriggerCors(payload.Cors),
-		},
-	}
-
-	updatedTrigger, err := refuncClient.RefuncV1beta3().Triggers(region).Update(context.TODO(), currentTrigger, metav1.UpdateOptions{})
+	updatedTrigger, err := controllers.UpdateTrigger(refuncClient, region, triggerName, payload.RevisionId, func(trigger *rfv1beta3.Trigger) error {
+		trigger.Spec.TriggerConfig = rfv1beta3.TriggerConfig{
+			HTTP: &rfv1beta3.HTTPTrigger{
+				AuthType: "None",
+				Cors:     rfv1beta3.HTTPTriggerCors(payload.Cors),
+			},
+		}
+		return nil
+	})
 	if err != nil {
-		klog.Errorf("ensure trigger error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("update trigger error %v", err)
+		if err == controllers.ErrPreconditionFailed {
+			awsutils.ErrorResponse(c, awsutils.ErrPreconditionFailed)
+		} else if errors.IsNotFound(err) {
+			awsutils.ErrorResponse(c, awsutils.ErrResourceNotFound)
+		} else {
+			awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		}
 		return
 	}
 
-	urlConfig, err := controllers.HTTPtriggerToURLConfig(*updatedTrigger)
+	urlConfig, err := controllers.HTTPtriggerToURLConfig(*updatedTrigger, c.GetString("awsRegion"), c.GetString("accountID"))
 	if err != nil {
-		klog.Errorf("httptrigger to lambda url config error %v", err)
-		awsutils.AWSErrorResponse(c, 500, "ServiceException")
+		utils.Log(c).Errorf("httptrigger to lambda url config error %v", err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
 		return
 	}
 
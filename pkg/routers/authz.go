@@ -0,0 +1,140 @@
+package routers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reviewCacheTTL is how long a SubjectAccessReview result is reused
+const reviewCacheTTL = 10 * time.Second
+
+// Authorizer checks the authenticated service account may do a route by SubjectAccessReview,
+// routes are mapped to verbs of refunc resources, e.g. `create funcdefs`, `delete triggers` and `invoke funcdefs`
+type Authorizer struct {
+	kubeClient kubernetes.Interface
+	enabled    bool
+
+	mu      sync.Mutex
+	reviews map[string]reviewResult
+}
+
+type reviewResult struct {
+	allowed    bool
+	reason     string
+	expiration time.Time
+}
+
+// NewAuthorizer creates authorizer, every route is allowed unless enabled
+func NewAuthorizer(kubeClient kubernetes.Interface, enabled bool) *Authorizer {
+	return &Authorizer{
+		kubeClient: kubeClient,
+		enabled:    enabled,
+		reviews:    make(map[string]reviewResult),
+	}
+}
+
+// Authorize requires verb of refunc resource, the resource name is the function of route if any
+func (a *Authorizer) Authorize(verb, resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.authorize(c, verb, resource)
+	}
+}
+
+// AuthorizeByMethod requires verb derived from http method, for apis that are not split by routes
+func (a *Authorizer) AuthorizeByMethod(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verb := "get"
+		switch c.Request.Method {
+		case http.MethodPut, http.MethodPost:
+			verb = "create"
+		case http.MethodDelete:
+			verb = "delete"
+		}
+		a.authorize(c, verb, resource)
+	}
+}
+
+func (a *Authorizer) authorize(c *gin.Context, verb, resource string) {
+	if !a.enabled {
+		c.Next()
+		return
+	}
+
+	ns := c.GetString("region")
+	home, sa := c.GetString("principalNamespace"), c.GetString("accessKeyID")
+	name := ""
+	if fn, err := awsutils.ParseFunctionName(c.Param("FunctionName")); err == nil && resource == rfv1beta3.FuncdefPluralName {
+		name = fn.Name
+	}
+
+	key := fmt.Sprintf("%s/%s|%s|%s|%s|%s", home, sa, ns, verb, resource, name)
+	result, err := a.review(key, home, sa, ns, verb, resource, name)
+	if err != nil {
+		utils.Log(c).Errorf("review %s error %v", key, err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		c.Abort()
+		return
+	}
+	if !result.allowed {
+		utils.Log(c).Infof("review %s denied, %s", key, result.reason)
+		awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("User: %s is not authorized to %s %s in namespace %s",
+			awsutils.UserArn(c.GetString("accountID"), sa), verb, resource, ns))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// review asks if service account sa of namespace home may do verb on resource in ns
+func (a *Authorizer) review(key, home, sa, ns, verb, resource, name string) (reviewResult, error) {
+	now := time.Now()
+	a.mu.Lock()
+	result, ok := a.reviews[key]
+	a.mu.Unlock()
+	if ok && now.Before(result.expiration) {
+		return result, nil
+	}
+
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   "system:serviceaccount:" + home + ":" + sa,
+			Groups: []string{"system:serviceaccounts", "system:serviceaccounts:" + home, "system:authenticated"},
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      verb,
+				Group:     rfv1beta3.GroupName,
+				Resource:  resource,
+				Name:      name,
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sar, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		return reviewResult{}, err
+	}
+	result = reviewResult{allowed: sar.Status.Allowed && !sar.Status.Denied, reason: sar.Status.Reason, expiration: now.Add(reviewCacheTTL)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// drop expired reviews while at it, the cache stays as small as identities in use
+	for k, r := range a.reviews {
+		if now.After(r.expiration) {
+			delete(a.reviews, k)
+		}
+	}
+	a.reviews[key] = result
+	return result, nil
+}
@@ -1,10 +1,9 @@
 package routers
 
 const (
-	LambdaLabelServiceAccount = "lambda.refunc.io/service-account"
-	authorizationHeader       = "Authorization"
-	authHeaderSignatureElem   = "Signature="
-	signatureQueryKey         = "X-Amz-Signature"
+	authorizationHeader = "Authorization"
+	signatureQueryKey   = "X-Amz-Signature"
+	securityTokenHeader = "X-Amz-Security-Token"
 
 	authHeaderPrefix = "AWS4-HMAC-SHA256"
 	timeFormat       = "20060102T150405Z"
@@ -12,51 +11,21 @@ const (
 	awsV4Request     = "aws4_request"
 )
 
-var (
-	allowSignHeaders = map[string]struct{}{
-		"Cache-Control":                         {},
-		"Content-Disposition":                   {},
-		"Content-Encoding":                      {},
-		"Content-Language":                      {},
-		"Content-Md5":                           {},
-		"Content-Type":                          {},
-		"Expires":                               {},
-		"If-Match":                              {},
-		"If-Modified-Since":                     {},
-		"If-None-Match":                         {},
-		"If-Unmodified-Since":                   {},
-		"Range":                                 {},
-		"X-Amz-Acl":                             {},
-		"X-Amz-Copy-Source":                     {},
-		"X-Amz-Copy-Source-If-Match":            {},
-		"X-Amz-Copy-Source-If-Modified-Since":   {},
-		"X-Amz-Copy-Source-If-None-Match":       {},
-		"X-Amz-Copy-Source-If-Unmodified-Since": {},
-		"X-Amz-Copy-Source-Range":               {},
-		"X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm": {},
-		"X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key":       {},
-		"X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5":   {},
-		"X-Amz-Grant-Full-control":                                    {},
-		"X-Amz-Grant-Read":                                            {},
-		"X-Amz-Grant-Read-Acp":                                        {},
-		"X-Amz-Grant-Write":                                           {},
-		"X-Amz-Grant-Write-Acp":                                       {},
-		"X-Amz-Metadata-Directive":                                    {},
-		"X-Amz-Mfa":                                                   {},
-		"X-Amz-Request-Payer":                                         {},
-		"X-Amz-Server-Side-Encryption":                                {},
-		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id":                 {},
-		"X-Amz-Server-Side-Encryption-Customer-Algorithm":             {},
-		"X-Amz-Server-Side-Encryption-Customer-Key":                   {},
-		"X-Amz-Server-Side-Encryption-Customer-Key-Md5":               {},
-		"X-Amz-Storage-Class":                                         {},
-		"X-Amz-Tagging":                                               {},
-		"X-Amz-Website-Redirect-Location":                             {},
-		"X-Amz-Content-Sha256":                                        {},
-		"X-Amz-Log-Type":                                              {},
-	}
-)
-
 type Config struct {
-	Rbac bool
+	Rbac       bool
+	CopyS3Code bool
+	// RegionNamespaces maps aws regions to namespaces, other regions are namespaces themselves
+	RegionNamespaces map[string]string
+	// AccountIDs maps namespaces to aws account ids
+	AccountIDs map[string]string
+	// AccountIDFromNamespace looks up account ids from namespace annotations
+	AccountIDFromNamespace bool
+	// TrustFromNamespace lets namespaces trust access keys of other namespaces by annotation
+	TrustFromNamespace bool
+	// Authorization authorizes authenticated service accounts by SubjectAccessReview, requires Rbac
+	Authorization bool
+	// IAMPolicies evaluates iam identity policies bound to service accounts, requires Rbac
+	IAMPolicies bool
+	// SessionTokenKey signs session tokens of temporary credentials, random if it's empty
+	SessionTokenKey string
 }
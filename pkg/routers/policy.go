@@ -0,0 +1,166 @@
+package routers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
+	"github.com/refunc/aws-api-gw/pkg/controllers/s3proxy"
+	"github.com/refunc/aws-api-gw/pkg/controllers/sts"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+)
+
+// lambdaActions maps routes to iam actions, CreateCodeUpload is an extension of gateway
+var lambdaActions = map[string]string{
+	"POST /2015-03-31/functions":                                "lambda:CreateFunction",
+	"GET /2015-03-31/functions/":                                "lambda:ListFunctions",
+	"GET /2015-03-31/functions/:FunctionName":                   "lambda:GetFunction",
+	"DELETE /2015-03-31/functions/:FunctionName":                "lambda:DeleteFunction",
+	"PUT /2015-03-31/functions/:FunctionName/code":              "lambda:UpdateFunctionCode",
+	"GET /2015-03-31/functions/:FunctionName/configuration":     "lambda:GetFunctionConfiguration",
+	"PUT /2015-03-31/functions/:FunctionName/configuration":     "lambda:UpdateFunctionConfiguration",
+	"POST /2015-03-31/functions/:FunctionName/invocations":      "lambda:InvokeFunction",
+	"POST /2015-03-31/event-source-mappings/":                   "lambda:CreateEventSourceMapping",
+	"GET /2015-03-31/event-source-mappings/":                    "lambda:ListEventSourceMappings",
+	"GET /2015-03-31/event-source-mappings/:EventSourceName":    "lambda:GetEventSourceMapping",
+	"DELETE /2015-03-31/event-source-mappings/:EventSourceName": "lambda:DeleteEventSourceMapping",
+	"PUT /2015-03-31/event-source-mappings/:EventSourceName":    "lambda:UpdateEventSourceMapping",
+	"GET /2021-10-31/functions/:FunctionName/url":               "lambda:GetFunctionUrlConfig",
+	"GET /2021-10-31/functions/:FunctionName/urls":              "lambda:ListFunctionUrlConfigs",
+	"POST /2021-10-31/functions/:FunctionName/url":              "lambda:CreateFunctionUrlConfig",
+	"PUT /2021-10-31/functions/:FunctionName/url":               "lambda:UpdateFunctionUrlConfig",
+	"DELETE /2021-10-31/functions/:FunctionName/url":            "lambda:DeleteFunctionUrlConfig",
+	"PUT /2017-10-31/functions/:FunctionName/concurrency":       "lambda:PutFunctionConcurrency",
+	"POST /refunc/code-uploads":                                 "lambda:CreateCodeUpload",
+}
+
+// WithPolicy evaluates iam identity policies of the authenticated service account, explicit deny first,
+// every call is allowed unless enabled
+func WithPolicy(policies *controllers.Policies, enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		home, sa := c.GetString("principalNamespace"), c.GetString("accessKeyID")
+		account := c.GetString("accountID")
+		principal := awsutils.UserArn(account, sa)
+		principalType := "User"
+		if session, ok := c.Get("session"); ok && session.(*sts.Session).RoleSessionName != "" {
+			principal = awsutils.AssumedRoleArn(account, sa, session.(*sts.Session).RoleSessionName)
+			principalType = "AssumedRole"
+		}
+
+		action, resource, ok := policyAction(c)
+		if !ok {
+			utils.Log(c).Warningf("no iam action of %s %s, denied", c.Request.Method, c.FullPath())
+			awsutils.ErrorResponse(c, awsutils.ErrAccessDenied)
+			c.Abort()
+			return
+		}
+		if action == "" {
+			// no permission required
+			c.Next()
+			return
+		}
+
+		docs, err := policies.PoliciesOf(home, sa)
+		if err != nil {
+			utils.Log(c).Errorf("load policies of %s/%s error %v, denied", home, sa, err)
+			awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("User: %s is not authorized to perform: %s on resource: %s because its identity-based policies are invalid", principal, action, resource))
+			c.Abort()
+			return
+		}
+
+		now := time.Now().UTC()
+		req := &awsutils.PolicyRequest{
+			Action:   action,
+			Resource: resource,
+			Conditions: map[string]string{
+				"aws:SourceIp":         c.ClientIP(),
+				"aws:CurrentTime":      now.Format(time.RFC3339),
+				"aws:EpochTime":        strconv.FormatInt(now.Unix(), 10),
+				"aws:SecureTransport":  strconv.FormatBool(c.Request.TLS != nil),
+				"aws:RequestedRegion":  c.GetString("awsRegion"),
+				"aws:username":         sa,
+				"aws:userid":           sa,
+				"aws:PrincipalArn":     principal,
+				"aws:PrincipalAccount": account,
+				"aws:PrincipalType":    principalType,
+			},
+		}
+		switch awsutils.EvaluatePolicies(docs, req) {
+		case awsutils.PolicyAllow:
+			c.Next()
+		case awsutils.PolicyExplicitDeny:
+			awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("User: %s is not authorized to perform: %s on resource: %s with an explicit deny in an identity-based policy", principal, action, resource))
+			c.Abort()
+		default:
+			awsutils.ErrorResponse(c, awsutils.ErrAccessDenied.WithMessage("User: %s is not authorized to perform: %s on resource: %s because no identity-based policy allows the %s action", principal, action, resource, action))
+			c.Abort()
+		}
+	}
+}
+
+// policyAction returns iam action and resource arn of route, empty action requires no permission
+func policyAction(c *gin.Context) (action, resource string, ok bool) {
+	region, account := c.GetString("awsRegion"), c.GetString("accountID")
+	fullPath := c.FullPath()
+
+	switch {
+	case strings.HasPrefix(fullPath, s3proxy.PathPrefix+"/"):
+		bucket, key := c.Param("path"), ""
+		bucket = strings.TrimPrefix(bucket, "/")
+		if i := strings.Index(bucket, "/"); i >= 0 {
+			bucket, key = bucket[:i], bucket[i+1:]
+		}
+		if key == "" {
+			return "s3:ListBucket", "arn:aws:s3:::" + bucket, true
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+			action = "s3:GetObject"
+		case http.MethodDelete:
+			action = "s3:DeleteObject"
+		default:
+			action = "s3:PutObject"
+		}
+		return action, "arn:aws:s3:::" + bucket + "/" + key, true
+
+	case strings.HasPrefix(fullPath, sts.PathPrefix+"/"):
+		switch op := c.Request.FormValue("Action"); op {
+		case "GetCallerIdentity", "":
+			return "", "", true
+		case "AssumeRole":
+			return "sts:AssumeRole", c.Request.FormValue("RoleArn"), true
+		default:
+			return "sts:" + op, "*", true
+		}
+	}
+
+	action, ok = lambdaActions[c.Request.Method+" "+fullPath]
+	if !ok {
+		return "", "", false
+	}
+	resource = "*"
+	if name := c.Param("FunctionName"); name != "" {
+		fn, err := awsutils.ParseFunctionName(name)
+		if err != nil {
+			// the handler answers invalid names
+			return action, awsutils.FunctionArn(region, account, name, ""), true
+		}
+		qualifier := fn.Qualifier
+		if qualifier == "" {
+			qualifier = c.Query("Qualifier")
+		}
+		resource = awsutils.FunctionArn(region, account, fn.Name, qualifier)
+	} else if uuid := c.Param("EventSourceName"); uuid != "" {
+		resource = awsutils.EventSourceMappingArn(region, account, uuid)
+	}
+	return action, resource, true
+}
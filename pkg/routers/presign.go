@@ -0,0 +1,114 @@
+package routers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+)
+
+// maxPresignExpires is the longest a presigned url lives, 7 days as aws
+const maxPresignExpires = 7 * 24 * 60 * 60
+
+// presignQueryKeys are auth parameters of presigned url, they are dropped once verified
+var presignQueryKeys = []string{
+	"X-Amz-Algorithm",
+	"X-Amz-Credential",
+	"X-Amz-Date",
+	"X-Amz-Expires",
+	"X-Amz-SignedHeaders",
+	"X-Amz-Content-Sha256",
+	securityTokenHeader,
+	signatureQueryKey,
+}
+
+type credentialScopeFunc func(c *gin.Context, credential string) (accessKeyID, region string, ok bool)
+
+type accessSecretFunc func(c *gin.Context, region, accessKeyID, sessionToken string) (secret, identity string, ok bool)
+
+// verifyPresigned verifies sigv4 carried by query parameters, aka presigned url
+func verifyPresigned(c *gin.Context, rbac bool, service string, credentialScope credentialScopeFunc, accessSecret accessSecretFunc) {
+	query := c.Request.URL.Query()
+	if query.Get("X-Amz-Algorithm") != awsutils.SigV4Algorithm {
+		awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("X-Amz-Algorithm must be %s.", awsutils.SigV4Algorithm))
+		c.Abort()
+		return
+	}
+	amzDate := query.Get("X-Amz-Date")
+	dt, err := time.Parse(timeFormat, amzDate)
+	if err != nil {
+		awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("X-Amz-Date is missing or invalid."))
+		c.Abort()
+		return
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > maxPresignExpires {
+		awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("X-Amz-Expires must be between 1 and %d seconds.", maxPresignExpires))
+		c.Abort()
+		return
+	}
+	// presigned urls are reusable until they expire, only dates from the future are skewed
+	if dt.After(time.Now().Add(maxClockSkew)) {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Signature not yet current: %s is still later than now + 15 min.", amzDate))
+		c.Abort()
+		return
+	}
+	if expiration := dt.Add(time.Duration(expires) * time.Second); time.Now().After(expiration) {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Signature expired at %s.", expiration.Format(timeFormat)))
+		c.Abort()
+		return
+	}
+
+	credential := query.Get("X-Amz-Credential")
+	accessKeyID, region, ok := credentialScope(c, credential)
+	if !ok {
+		return
+	}
+
+	sessionToken := query.Get(securityTokenHeader)
+	if sessionToken == "" {
+		sessionToken = c.Request.Header.Get(securityTokenHeader)
+	}
+	secret, identity, ok := accessSecret(c, region, accessKeyID, sessionToken)
+	if !ok {
+		return
+	}
+
+	if rbac {
+		signedHeaders := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+		if !checkSignedHeaders(c, signedHeaders) {
+			return
+		}
+
+		// links handed out for webhooks sign UNSIGNED-PAYLOAD in query, s3 presigns it by default.
+		// The query stands for the header, signers sign it as a header too.
+		declared := query.Get("X-Amz-Content-Sha256")
+		if declared != "" && c.Request.Header.Get("X-Amz-Content-Sha256") == "" {
+			c.Request.Header.Set("X-Amz-Content-Sha256", declared)
+		}
+		declared = c.Request.Header.Get("X-Amz-Content-Sha256")
+		if declared == "" && service == "s3" {
+			declared = awsutils.UnsignedPayload
+		}
+		hash, cleanup, ok := payloadHash(c, service, declared, true)
+		if !ok {
+			return
+		}
+		defer cleanup()
+		if !verifySignature(c, newSigV4Request(c, service, credential, signedHeaders, hash, amzDate), secret, query.Get(signatureQueryKey)) {
+			return
+		}
+	}
+
+	// handlers and upstreams never see auth parameters
+	for _, k := range presignQueryKeys {
+		query.Del(k)
+	}
+	c.Request.URL.RawQuery = query.Encode()
+
+	c.Set("region", region)
+	c.Set("accessKeyID", identity)
+	c.Next()
+}
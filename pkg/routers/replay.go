@@ -0,0 +1,102 @@
+package routers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+)
+
+// maxClockSkew is how far X-Amz-Date may be off from now, 15 minutes as aws
+const maxClockSkew = 15 * time.Minute
+
+// checkClockSkew answers InvalidSignatureException if dt is too far off, reports if it's ok
+func checkClockSkew(c *gin.Context, dt time.Time) bool {
+	now := time.Now().UTC()
+	if dt.Before(now.Add(-maxClockSkew)) {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Signature expired: %s is now earlier than %s (%s - 15 min.)",
+			dt.Format(timeFormat), now.Add(-maxClockSkew).Format(timeFormat), now.Format(timeFormat)))
+		c.Abort()
+		return false
+	}
+	if dt.After(now.Add(maxClockSkew)) {
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Signature not yet current: %s is still later than %s (%s + 15 min.)",
+			dt.Format(timeFormat), now.Add(maxClockSkew).Format(timeFormat), now.Format(timeFormat)))
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// replayCache remembers signatures of mutating requests within the clock skew window. A signature is reserved
+// before its request is handled, so copies sent while it's running are rejected, and released if the request
+// is answered with a 5xx or cancelled, so sdks can retry the same signed request after a failure or a timeout.
+// It's per replica, replicas of gateway don't share it.
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]time.Time)}
+}
+
+func replayKey(accessKeyID, signature string) string {
+	return fmt.Sprintf("%s/%s", accessKeyID, signature)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// checkReplay reserves signature of a mutating request, answers InvalidSignatureException if it's seen,
+// reports if it's ok
+func (r *replayCache) checkReplay(c *gin.Context, key string) bool {
+	if !isMutating(c.Request.Method) || r.add(key, time.Now()) {
+		return true
+	}
+	awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Signature has already been used, sign the request again."))
+	c.Abort()
+	return false
+}
+
+// release forgets signature of a failed or cancelled mutating request, it may be retried,
+// nothing is written yet if handler panicked
+func (r *replayCache) release(c *gin.Context, key string) {
+	if !isMutating(c.Request.Method) {
+		return
+	}
+	if !c.Writer.Written() || c.Writer.Status() >= http.StatusInternalServerError || c.Request.Context().Err() != nil {
+		r.mu.Lock()
+		delete(r.seen, key)
+		r.mu.Unlock()
+	}
+}
+
+// add reports false if key is already seen
+func (r *replayCache) add(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastPrune) > time.Minute {
+		for k, expiration := range r.seen {
+			if now.After(expiration) {
+				delete(r.seen, k)
+			}
+		}
+		r.lastPrune = now
+	}
+	if expiration, ok := r.seen[key]; ok && !now.After(expiration) {
+		return false
+	}
+	// a signature is accepted up to skew after its date, which is at most skew ahead of now
+	r.seen[key] = now.Add(2 * maxClockSkew)
+	return true
+}
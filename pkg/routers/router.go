@@ -2,81 +2,174 @@ package routers
 
 import (
 	"bytes"
+	"crypto/rand"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"regexp"
 	"strings"
 	"time"
 
 	nats "github.com/nats-io/nats.go"
+	"github.com/refunc/aws-api-gw/pkg/controllers"
 	"github.com/refunc/aws-api-gw/pkg/controllers/concurrency"
 	"github.com/refunc/aws-api-gw/pkg/controllers/eventsourcemapping"
 	"github.com/refunc/aws-api-gw/pkg/controllers/functions"
+	"github.com/refunc/aws-api-gw/pkg/controllers/s3proxy"
+	"github.com/refunc/aws-api-gw/pkg/controllers/sts"
+	"github.com/refunc/aws-api-gw/pkg/controllers/uploads"
 	"github.com/refunc/aws-api-gw/pkg/controllers/urls"
+	"github.com/refunc/aws-api-gw/pkg/services"
+	"github.com/refunc/aws-api-gw/pkg/utils"
 	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
-	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
-	awsSigner "github.com/aws/aws-sdk-go/aws/signer/v4"
-
 	"github.com/gin-gonic/gin"
+	rfv1beta3 "github.com/refunc/refunc/pkg/apis/refunc/v1beta3"
 	"github.com/refunc/refunc/pkg/env"
 	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
 )
 
 func CreateHTTPRouter(sc sharedcfg.Configs, cfg Config, stopC <-chan struct{}) *gin.Engine {
 
+	services.CopyS3Code = cfg.CopyS3Code
+
 	router := gin.New()
-	router.Use(gin.Logger())
+	router.Use(WithRequestID())
+	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %s | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.Keys["requestID"],
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			param.ErrorMessage,
+		)
+	}))
 	router.Use(gin.Recovery())
 	router.Use(WithClientSet(sc, stopC))
-	router.Use(WithAwsSign(sc, cfg.Rbac))
-	functionApis := router.Group("/2015-03-31")
+	accounts := controllers.NewAccountIDs(sc, cfg.AccountIDs, cfg.AccountIDFromNamespace)
+	go func() {
+		if !cache.WaitForCacheSync(stopC, accounts.HasSynced) {
+			klog.Errorln("Fail wait for namespace cache sync")
+		}
+	}()
+
+	credentials, err := controllers.NewCredentials(sc, cfg.TrustFromNamespace)
+	if err != nil {
+		klog.Fatalf("index credential secrets error %v", err)
+	}
+	sessionKey := []byte(cfg.SessionTokenKey)
+	if len(sessionKey) == 0 {
+		klog.Warning("session token key is not set, temporary credentials are invalidated on restart and not accepted by other replicas")
+		sessionKey = make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			klog.Fatalf("generate session token key error %v", err)
+		}
+	}
+	sessions := sts.NewSessionTokens(sessionKey)
+
+	// authorize service accounts by SubjectAccessReview
+	authz := NewAuthorizer(sc.KubeClient(), cfg.Authorization)
+	funcdefs, triggers := rfv1beta3.FuncdefPluralName, rfv1beta3.TriggerPluralName
+	// evaluate iam identity policies of service accounts
+	var policies *controllers.Policies
+	if cfg.IAMPolicies {
+		policies = controllers.NewPolicies(sc)
+		go func() {
+			if !cache.WaitForCacheSync(stopC, policies.HasSynced) {
+				klog.Errorln("Fail wait for policy cache sync")
+			}
+		}()
+	}
+
+	lambdaApis := router.Group("/", WithAwsSign(sc, cfg.Rbac, "lambda", cfg.RegionNamespaces, credentials, sessions), WithAccountID(accounts), WithPolicy(policies, cfg.IAMPolicies))
+	functionApis := lambdaApis.Group("/2015-03-31")
 	{
-		functionApis.POST("/functions", functions.CreateFunction)
-		functionApis.GET("/functions/", functions.ListFunction)
-		functionApis.GET("/functions/:FunctionName", functions.GetFunction)
-		functionApis.DELETE("/functions/:FunctionName", functions.DeleteFunction)
-		functionApis.PUT("/functions/:FunctionName/code", functions.UpdateFunctionCode)
-		functionApis.PUT("/functions/:FunctionName/configuration", functions.UpdateFunctionConfiguration)
-		functionApis.POST("/functions/:FunctionName/invocations", functions.InvokeFunction)
+		functionApis.POST("/functions", authz.Authorize("create", funcdefs), functions.CreateFunction)
+		functionApis.GET("/functions/", authz.Authorize("list", funcdefs), functions.ListFunction)
+		functionApis.GET("/functions/:FunctionName", authz.Authorize("get", funcdefs), functions.GetFunction)
+		functionApis.DELETE("/functions/:FunctionName", authz.Authorize("delete", funcdefs), functions.DeleteFunction)
+		functionApis.PUT("/functions/:FunctionName/code", authz.Authorize("update", funcdefs), functions.UpdateFunctionCode)
+		functionApis.GET("/functions/:FunctionName/configuration", authz.Authorize("get", funcdefs), functions.GetFunctionConfiguration)
+		functionApis.PUT("/functions/:FunctionName/configuration", authz.Authorize("update", funcdefs), functions.UpdateFunctionConfiguration)
+		functionApis.POST("/functions/:FunctionName/invocations", authz.Authorize("invoke", funcdefs), functions.InvokeFunction)
 	}
 	eventsourcemappingApis := functionApis.Group("/event-source-mappings")
 	{
-		eventsourcemappingApis.POST("/", eventsourcemapping.CreateEventSource)
-		eventsourcemappingApis.GET("/", eventsourcemapping.ListEventSource)
-		eventsourcemappingApis.GET("/:EventSourceName", eventsourcemapping.GetEventSource) //EventSourceName: lambda-<trigger-arn>-<func-name>-<event-name>
-		eventsourcemappingApis.DELETE("/:EventSourceName", eventsourcemapping.DeleteEventSource)
-		eventsourcemappingApis.PUT("/:EventSourceName", eventsourcemapping.UpdateEventSource)
+		eventsourcemappingApis.POST("/", authz.Authorize("create", triggers), eventsourcemapping.CreateEventSource)
+		eventsourcemappingApis.GET("/", authz.Authorize("list", triggers), eventsourcemapping.ListEventSource)
+		eventsourcemappingApis.GET("/:EventSourceName", authz.Authorize("get", triggers), eventsourcemapping.GetEventSource) //EventSourceName: lambda-<trigger-arn>-<func-name>-<event-name>
+		eventsourcemappingApis.DELETE("/:EventSourceName", authz.Authorize("delete", triggers), eventsourcemapping.DeleteEventSource)
+		eventsourcemappingApis.PUT("/:EventSourceName", authz.Authorize("update", triggers), eventsourcemapping.UpdateEventSource)
 	}
-	urlApis := router.Group("/2021-10-31")
+	urlApis := lambdaApis.Group("/2021-10-31")
 	{
-		urlApis.GET("/functions/:FunctionName/url", urls.GetURL)
-		urlApis.GET("/functions/:FunctionName/urls", urls.ListURL)
-		urlApis.POST("/functions/:FunctionName/url", urls.CreateURL)
-		urlApis.PUT("/functions/:FunctionName/url", urls.UpdateURL)
-		urlApis.DELETE("/functions/:FunctionName/url", urls.DeleteURL)
+		urlApis.GET("/functions/:FunctionName/url", authz.Authorize("get", triggers), urls.GetURL)
+		urlApis.GET("/functions/:FunctionName/urls", authz.Authorize("list", triggers), urls.ListURL)
+		urlApis.POST("/functions/:FunctionName/url", authz.Authorize("create", triggers), urls.CreateURL)
+		urlApis.PUT("/functions/:FunctionName/url", authz.Authorize("update", triggers), urls.UpdateURL)
+		urlApis.DELETE("/functions/:FunctionName/url", authz.Authorize("delete", triggers), urls.DeleteURL)
 	}
-	concurrencyApis := router.Group("/2017-10-31")
+	concurrencyApis := lambdaApis.Group("/2017-10-31")
 	{
-		concurrencyApis.PUT("/functions/:FunctionName/concurrency", concurrency.UpdateFunctionConcurrency)
+		concurrencyApis.PUT("/functions/:FunctionName/concurrency", authz.Authorize("update", funcdefs), concurrency.UpdateFunctionConcurrency)
+	}
+	// gateway extensions, not part of aws lambda api
+	refuncApis := lambdaApis.Group("/refunc")
+	{
+		refuncApis.POST("/code-uploads", authz.Authorize("create", funcdefs), uploads.CreateCodeUpload)
+	}
+	// s3 api proxy of refunc minio, use http://<gateway>/s3 as s3 endpoint url with path style addressing
+	s3Apis := router.Group(s3proxy.PathPrefix, WithAwsSign(sc, cfg.Rbac, "s3", cfg.RegionNamespaces, credentials, sessions), WithAccountID(accounts), WithPolicy(policies, cfg.IAMPolicies))
+	{
+		s3Apis.Any("/*path", authz.AuthorizeByMethod("s3objects"), s3proxy.Proxy)
+	}
+	// sts query api issuing temporary credentials, use http://<gateway>/sts as sts endpoint url
+	stsApis := router.Group(sts.PathPrefix, WithAwsSign(sc, cfg.Rbac, "sts", cfg.RegionNamespaces, credentials, sessions), WithAccountID(accounts), WithPolicy(policies, cfg.IAMPolicies))
+	{
+		stsApis.GET("/", sts.Handler(sessions))
+		stsApis.POST("/", sts.Handler(sessions))
 	}
 	return router
 }
 
+// WithRequestID tags every call with a request id and answers it with the standard aws headers
+func WithRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := utils.NewRequestID()
+		c.Set("requestID", requestID)
+		c.Header(utils.HeaderRequestID, requestID)
+		c.Header("Date", time.Now().UTC().Format(http.TimeFormat))
+		c.Next()
+	}
+}
+
+// WithAccountID sets account id of the authenticated region
+func WithAccountID(accounts *controllers.AccountIDs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("accountID", accounts.AccountID(c.GetString("region")))
+		c.Next()
+	}
+}
+
 func WithClientSet(sc sharedcfg.Configs, stopC <-chan struct{}) gin.HandlerFunc {
 	kubeClient := sc.KubeClient()
 	refuncClient := sc.RefuncClient()
 	kubeInformers := sc.KubeInformers()
 	refuncInformers := sc.RefuncInformers()
 	refuncFundefLister := refuncInformers.Refunc().V1beta3().Funcdeves().Lister()
+	refuncFuncinstLister := refuncInformers.Refunc().V1beta3().Funcinsts().Lister()
+	refuncXenvLister := refuncInformers.Refunc().V1beta3().Xenvs().Lister()
 	serviceAccountLister := kubeInformers.Core().V1().ServiceAccounts().Lister()
 	wantedInformers := []cache.InformerSynced{
 		refuncInformers.Refunc().V1beta3().Funcdeves().Informer().HasSynced,
+		refuncInformers.Refunc().V1beta3().Funcinsts().Informer().HasSynced,
+		refuncInformers.Refunc().V1beta3().Xenvs().Informer().HasSynced,
 		kubeInformers.Core().V1().ServiceAccounts().Informer().HasSynced,
 		kubeInformers.Core().V1().Secrets().Informer().HasSynced,
 	}
@@ -100,150 +193,214 @@ func WithClientSet(sc sharedcfg.Configs, stopC <-chan struct{}) gin.HandlerFunc
 		c.Set("kc", kubeClient)
 		c.Set("rc", refuncClient)
 		c.Set("funcdefLister", refuncFundefLister)
+		c.Set("funcinstLister", refuncFuncinstLister)
+		c.Set("xenvLister", refuncXenvLister)
 		c.Set("serviceAccountLister", serviceAccountLister)
 		c.Set("nats", natsConn)
 		c.Next()
 	}
 }
 
-func WithAwsSign(sc sharedcfg.Configs, rbac bool) gin.HandlerFunc {
+// WithAwsSign verifies aws sigv4 of service, lambda, s3 or sts, against credential secrets or session tokens,
+// the region of credential is the namespace unless mapped by regionNamespaces
+func WithAwsSign(sc sharedcfg.Configs, rbac bool, service string, regionNamespaces map[string]string, credentials *controllers.Credentials, sessions *sts.SessionTokens) gin.HandlerFunc {
+	ns := sc.Namespace()
+	// credentialScope checks credential <key>/<date>/<region>/<service>/aws4_request and returns namespace of region,
+	// answers error if it's not ok
+	var credentialScope credentialScopeFunc = func(c *gin.Context, credential string) (accessKeyID, region string, ok bool) {
+		credentials := strings.Split(credential, "/")
+		if len(credentials) != 5 || credentials[3] != service || credentials[4] != awsV4Request {
+			awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("Credential should be scoped to service %s.", service))
+			c.Abort()
+			return
+		}
+		if credentials[2] == "" {
+			awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("Credential should be scoped to a valid region."))
+			c.Abort()
+			return
+		}
+		region = credentials[2]
+		if mapped, ok := regionNamespaces[region]; ok {
+			region = mapped
+		}
+		if ns != "" && ns != region {
+			awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("Credential should be scoped to a region of namespace %s.", ns))
+			c.Abort()
+			return
+		}
+		// arns are in the region the client asked
+		c.Set("awsRegion", credentials[2])
+		return credentials[0], region, true
+	}
 
-	kubeInformers := sc.KubeInformers()
-	serviceAccountLister := kubeInformers.Core().V1().ServiceAccounts().Lister()
-	secretLister := kubeInformers.Core().V1().Secrets().Lister()
+	// accessSecret gets secret of access key and the identity it acts as, answers error if it's not found,
+	// temporary credentials carry a session token and act as the service account of session
+	var accessSecret accessSecretFunc = func(c *gin.Context, region, accessKeyID, sessionToken string) (string, string, bool) {
+		if sessionToken != "" {
+			session, err := sessions.Verify(sessionToken)
+			if err == sts.ErrExpiredToken {
+				awsutils.ErrorResponse(c, awsutils.ErrExpiredToken)
+				c.Abort()
+				return "", "", false
+			}
+			if err != nil || session.AccessKeyID != accessKeyID || session.Namespace != region {
+				awsutils.ErrorResponse(c, awsutils.ErrUnrecognizedClient)
+				c.Abort()
+				return "", "", false
+			}
+			if rbac && !checkIssuer(c, credentials, sessions, session) {
+				return "", "", false
+			}
+			c.Set("session", session)
+			if session.Issuer != nil {
+				c.Set("issuer", session.Issuer)
+			}
+			c.Set("principalNamespace", session.Namespace)
+			if session.SubjectNamespace != "" {
+				c.Set("principalNamespace", session.SubjectNamespace)
+			}
+			return sessions.Secret(sessionToken), session.Subject, true
+		}
+		if !rbac {
+			c.Set("principalNamespace", region)
+			return "", accessKeyID, true
+		}
+		cred, err := credentials.Lookup(region, accessKeyID)
+		if err != nil {
+			utils.Log(c).Errorf("get credential of %s/%s error %v", region, accessKeyID, err)
+			if k8serrors.IsNotFound(err) {
+				awsutils.ErrorResponse(c, awsutils.ErrUnrecognizedClient)
+			} else {
+				awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+			}
+			c.Abort()
+			return "", "", false
+		}
+		c.Set("principalNamespace", cred.Namespace)
+		c.Set("issuer", &sts.Issuer{Namespace: region, AccessKeyID: accessKeyID, Fingerprint: sessions.Fingerprint(cred.SecretAccessKey)})
+		return cred.SecretAccessKey, cred.ServiceAccount, true
+	}
 
-	ns := sc.Namespace()
-	reg := regexp.MustCompile(`Credential=(.*\/.*\/.*\/lambda/aws4_request), SignedHeaders`)
+	replays := newReplayCache()
 	return func(c *gin.Context) {
+		if c.Request.Header.Get(authorizationHeader) == "" && c.Request.URL.Query().Get(signatureQueryKey) != "" {
+			verifyPresigned(c, rbac, service, credentialScope, accessSecret)
+			return
+		}
+
 		amzDate := c.Request.Header.Get("X-Amz-Date")
 		dt, err := time.Parse(timeFormat, amzDate)
 		if err != nil {
-			klog.Error(err)
-			awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
+			utils.Log(c).Error(err)
+			awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("X-Amz-Date header is missing or invalid."))
 			c.Abort()
 			return
 		}
+		if !checkClockSkew(c, dt) {
+			return
+		}
 
 		authorization := c.Request.Header.Get(authorizationHeader)
 		if authorization == "" {
-			awsutils.AWSErrorResponse(c, 400, "InvalidAuthorizationException")
+			awsutils.ErrorResponse(c, awsutils.ErrMissingAuthenticationToken)
 			c.Abort()
 			return
 		}
 
-		matches := reg.FindStringSubmatch(authorization)
-		if len(matches) != 2 {
-			awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
+		auth, ok := parseAuthorization(authorization)
+		if !ok {
+			awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("Authorization header requires Credential, SignedHeaders and Signature."))
 			c.Abort()
 			return
 		}
-		credentials := strings.Split(matches[1], "/")
-		if len(credentials) != 5 {
-			awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-			c.Abort()
+		accessKeyID, region, ok := credentialScope(c, auth.Credential)
+		if !ok {
 			return
 		}
-		region := credentials[2]
-		if ns != "" && ns != region {
-			awsutils.AWSErrorResponse(c, 400, "InvalidRegionException")
-			c.Abort()
-			return
-		}
-		if region == "" {
-			awsutils.AWSErrorResponse(c, 400, "InvalidRegionException")
-			c.Abort()
+
+		secret, identity, ok := accessSecret(c, region, accessKeyID, c.Request.Header.Get(securityTokenHeader))
+		if !ok {
 			return
 		}
 
-		accessKeyID := credentials[0]
 		if rbac {
-			// gen access_key_id and access_secret base on serviceaccount
-			sa, err := serviceAccountLister.ServiceAccounts(region).Get(accessKeyID)
-			if err != nil {
-				klog.Error(err)
-				awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-				c.Abort()
+			if !checkSignedHeaders(c, auth.SignedHeaders) {
 				return
 			}
-			var secret *corev1.Secret
-			if len(sa.Secrets) == 1 {
-				secret, err = secretLister.Secrets(region).Get(sa.Secrets[0].Name)
-				if err != nil {
-					klog.Error(err)
-					awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-					c.Abort()
-					return
-				}
-			} else {
-				secrets, err := secretLister.Secrets(region).List(labels.Everything())
-				if err != nil {
-					klog.Error(err)
-					awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-					c.Abort()
-					return
-				}
-				for _, sec := range secrets {
-					if sec.Annotations["kubernetes.io/service-account.name"] == sa.Name {
-						secret = sec
-						break
-					}
-				}
-			}
-			if secret == nil {
-				klog.Errorf("can't find %s/%s secret", sa.Namespace, sa.Name)
-				awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-				c.Abort()
-				return
-			}
-			tokenBts, ok := secret.Data["token"]
+			hash, cleanup, ok := payloadHash(c, service, c.Request.Header.Get("X-Amz-Content-Sha256"), false)
 			if !ok {
-				klog.Error(err)
-				awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-				c.Abort()
-				return
-			}
-			accessSecret := string(tokenBts)
-
-			//copy origin body bytes
-			bodyBts, err := io.ReadAll(c.Request.Body)
-			if err != nil {
-				klog.Error(err)
-				awsutils.AWSErrorResponse(c, 500, "ServiceException")
-				c.Abort()
 				return
 			}
-			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBts))
-
-			//verify aws signature without body sha256
-			signer := awsSigner.NewSigner(awsCredentials.NewStaticCredentials(accessKeyID, accessSecret, ""))
-			signReq, _ := http.NewRequest(c.Request.Method, c.Request.URL.String(), nil)
-			signReq.URL, signReq.Host = c.Request.URL, c.Request.Host
-			for k := range c.Request.Header {
-				if _, ok := allowSignHeaders[k]; !(ok || strings.HasPrefix(k, "X-Amz-Meta-") || strings.HasPrefix(k, "X-Amz-Object-Lock-")) {
-					continue
-				}
-				signReq.Header.Set(k, c.Request.Header.Get(k))
-			}
-
-			//signer.Debug = aws.LogDebugWithSigning
-			//signer.Logger = aws.NewDefaultLogger()
-			_, err = signer.Sign(signReq, bytes.NewReader(bodyBts), "lambda", region, dt)
-			if err != nil {
-				klog.Error(err)
-				awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-				c.Abort()
+			defer cleanup()
+			if !verifySignature(c, newSigV4Request(c, service, auth.Credential, auth.SignedHeaders, hash, amzDate), secret, auth.Signature) {
 				return
 			}
+		}
 
-			if authorization != signReq.Header.Get(authorizationHeader) {
-				klog.Infof("verify sign diff (%s) -> (%s)", authorization, signReq.Header.Get(authorizationHeader))
-				awsutils.AWSErrorResponse(c, 400, "InvalidCredentialException")
-				c.Abort()
-				return
-			}
+		replay := replayKey(accessKeyID, auth.Signature)
+		if !replays.checkReplay(c, replay) {
+			return
 		}
 
 		c.Set("region", region)
+		c.Set("accessKeyID", identity)
+		defer replays.release(c, replay)
 		c.Next()
 	}
 }
+
+// checkIssuer answers error if the access key session is derived from is deleted or rotated, reports if it's ok
+func checkIssuer(c *gin.Context, credentials *controllers.Credentials, sessions *sts.SessionTokens, session *sts.Session) bool {
+	issuer := session.Issuer
+	if issuer == nil {
+		utils.Log(c).V(2).Infof("session %s has no issuer", session.AccessKeyID)
+		awsutils.ErrorResponse(c, awsutils.ErrUnrecognizedClient)
+		c.Abort()
+		return false
+	}
+	cred, err := credentials.Lookup(issuer.Namespace, issuer.AccessKeyID)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		utils.Log(c).Errorf("get credential of %s/%s error %v", issuer.Namespace, issuer.AccessKeyID, err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		c.Abort()
+		return false
+	}
+	if err != nil || sessions.Fingerprint(cred.SecretAccessKey) != issuer.Fingerprint {
+		utils.Log(c).Infof("access key %s/%s of session %s is deleted or rotated", issuer.Namespace, issuer.AccessKeyID, session.AccessKeyID)
+		awsutils.ErrorResponse(c, awsutils.ErrUnrecognizedClient)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// maxMemoryBody is the biggest request body kept in memory while verifying signature
+const maxMemoryBody = 1 << 20
+
+// spoolBody makes request body seekable, bodies larger than maxMemoryBody are spooled to a temp file
+func spoolBody(r *http.Request) (io.ReadSeeker, func(), error) {
+	if r.ContentLength >= 0 && r.ContentLength <= maxMemoryBody {
+		bodyBts, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(bodyBts), func() {}, nil
+	}
+	file, err := os.CreateTemp("", "aws-api-gw-body-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	if _, err := io.Copy(file, r.Body); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return file, cleanup, nil
+}
@@ -0,0 +1,144 @@
+package routers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils"
+	"github.com/refunc/aws-api-gw/pkg/utils/awsutils"
+)
+
+// sigV4Auth is the parsed Authorization header of sigv4
+type sigV4Auth struct {
+	Credential    string
+	SignedHeaders []string
+	Signature     string
+}
+
+// parseAuthorization parses `AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=...`
+func parseAuthorization(authorization string) (*sigV4Auth, bool) {
+	if !strings.HasPrefix(authorization, authHeaderPrefix+" ") {
+		return nil, false
+	}
+	auth := &sigV4Auth{}
+	for _, elem := range strings.Split(strings.TrimPrefix(authorization, authHeaderPrefix+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(elem), "=", 2)
+		if len(kv) != 2 {
+			return nil, false
+		}
+		switch kv[0] {
+		case "Credential":
+			auth.Credential = kv[1]
+		case "SignedHeaders":
+			auth.SignedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			auth.Signature = kv[1]
+		}
+	}
+	if auth.Credential == "" || len(auth.SignedHeaders) == 0 || auth.Signature == "" {
+		return nil, false
+	}
+	return auth, true
+}
+
+// checkSignedHeaders answers IncompleteSignatureException unless host is signed, reports if it's ok
+func checkSignedHeaders(c *gin.Context, signedHeaders []string) bool {
+	for _, h := range signedHeaders {
+		if h == "host" {
+			return true
+		}
+	}
+	awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("SignedHeaders must include host."))
+	c.Abort()
+	return false
+}
+
+// payloadHash resolves the payload hash a signature covers from declared X-Amz-Content-Sha256.
+// s3 bodies are streamed to upstream untouched, which verifies them, UNSIGNED-PAYLOAD included.
+// Other bodies are hashed, unless unsigned is allowed and declared, which presigned urls may do,
+// big body is spooled to disk until cleanup is called.
+func payloadHash(c *gin.Context, service, declared string, allowUnsigned bool) (string, func(), bool) {
+	if (service == "s3" && declared != "") || (allowUnsigned && declared == awsutils.UnsignedPayload) {
+		return declared, func() {}, true
+	}
+	if service == "s3" {
+		awsutils.ErrorResponse(c, awsutils.ErrIncompleteSignature.WithMessage("X-Amz-Content-Sha256 header is required."))
+		c.Abort()
+		return "", nil, false
+	}
+
+	spooled, cleanup, err := spoolBody(c.Request)
+	if err != nil {
+		utils.Log(c).Error(err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		c.Abort()
+		return "", nil, false
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, spooled); err == nil {
+		_, err = spooled.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		utils.Log(c).Error(err)
+		awsutils.ErrorResponse(c, awsutils.ErrServiceException)
+		c.Abort()
+		return "", nil, false
+	}
+	c.Request.Body = io.NopCloser(spooled)
+
+	computed := hex.EncodeToString(hash.Sum(nil))
+	if declared != "" && declared != computed {
+		cleanup()
+		awsutils.ErrorResponse(c, awsutils.ErrInvalidSignature.WithMessage("The provided 'x-amz-content-sha256' header does not match what was computed."))
+		c.Abort()
+		return "", nil, false
+	}
+	return computed, cleanup, true
+}
+
+// newSigV4Request collects what the signature of c covers
+func newSigV4Request(c *gin.Context, service, credential string, signedHeaders []string, payloadHash, amzDate string) *awsutils.SigV4Request {
+	// net/http moves Content-Length out of headers
+	header := c.Request.Header.Clone()
+	if c.Request.ContentLength >= 0 && header.Get("Content-Length") == "" {
+		header.Set("Content-Length", strconv.FormatInt(c.Request.ContentLength, 10))
+	}
+	scope := credential
+	if i := strings.Index(credential, "/"); i >= 0 {
+		scope = credential[i+1:]
+	}
+	return &awsutils.SigV4Request{
+		Method:                 c.Request.Method,
+		Path:                   c.Request.URL.EscapedPath(),
+		Query:                  c.Request.URL.Query(),
+		Header:                 header,
+		Host:                   c.Request.Host,
+		SignedHeaders:          signedHeaders,
+		PayloadHash:            payloadHash,
+		AmzDate:                amzDate,
+		Scope:                  scope,
+		DisableURIPathEscaping: service == "s3",
+	}
+}
+
+// verifySignature answers InvalidSignatureException if signature mismatches, reports if it's ok,
+// the canonical request and string to sign are answered in debug mode as aws does
+func verifySignature(c *gin.Context, req *awsutils.SigV4Request, secret, signature string) bool {
+	if req.VerifySignature(secret, signature) {
+		return true
+	}
+	utils.Log(c).V(1).Infof("verify sign diff, canonical request:\n%s", req.CanonicalRequest())
+	err := awsutils.ErrInvalidSignature
+	if gin.IsDebugging() {
+		err = err.WithMessage("%s\n\nThe Canonical String for this request should have been\n'%s'\n\nThe String-to-Sign should have been\n'%s'\n",
+			err.Message, req.CanonicalRequest(), req.StringToSign())
+	}
+	awsutils.ErrorResponse(c, err)
+	c.Abort()
+	return false
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/refunc/refunc/pkg/env"
+	rflister "github.com/refunc/refunc/pkg/generated/listers/refunc/v1beta3"
+	"github.com/refunc/refunc/pkg/utils/cmdutil/sharedcfg"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// CodeGCConfig configures the orphaned code collector
+type CodeGCConfig struct {
+	// how often to reconcile, 0 disables the collector
+	Interval time.Duration
+	// objects modified within grace period are kept, they may be referenced soon
+	GracePeriod time.Duration
+	// only report orphaned objects without removing them
+	DryRun bool
+}
+
+// CodeCollector removes code objects under funcs/<ns>/ which are referenced by no funcdef
+type CodeCollector struct {
+	cfg           CodeGCConfig
+	namespace     string
+	funcdefLister rflister.FuncdefLister
+	hasSynced     cache.InformerSynced
+}
+
+// NewCodeCollector creates a collector scoped to the namespace of sc, empty namespace means all
+func NewCodeCollector(sc sharedcfg.Configs, cfg CodeGCConfig) *CodeCollector {
+	informer := sc.RefuncInformers().Refunc().V1beta3().Funcdeves()
+	return &CodeCollector{
+		cfg:           cfg,
+		namespace:     sc.Namespace(),
+		funcdefLister: informer.Lister(),
+		hasSynced:     informer.Informer().HasSynced,
+	}
+}
+
+// Run reconciles periodically until stopC closed
+func (gc *CodeCollector) Run(stopC <-chan struct{}) {
+	if gc.cfg.Interval <= 0 {
+		return
+	}
+	if !cache.WaitForCacheSync(stopC, gc.hasSynced) {
+		klog.Errorln("(codegc) fail wait for cache sync")
+		return
+	}
+	wait.Until(func() {
+		if err := gc.Reconcile(); err != nil {
+			klog.Errorf("(codegc) reconcile error %v", err)
+		}
+	}, gc.cfg.Interval, stopC)
+}
+
+// Reconcile removes orphaned code objects once, in dry-run mode they are only reported
+func (gc *CodeCollector) Reconcile() error {
+	fndefs, err := gc.funcdefLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	// referenced objects keyed by bucket/key, bodies are either s3:// or minio://
+	referenced := map[string]struct{}{}
+	for _, fndef := range fndefs {
+		if bucket, key, err := parseCodeBody(fndef.Spec.Body); err == nil {
+			referenced[bucket+"/"+key] = struct{}{}
+		}
+	}
+
+	prefix := strings.TrimPrefix(fmt.Sprintf("%s/funcs/", env.GlobalScopeRoot), "/")
+	if gc.namespace != "" {
+		prefix = prefix + gc.namespace + "/"
+	}
+	if err := gc.collect(prefix, referenced, gc.cfg.GracePeriod); err != nil {
+		return err
+	}
+
+	// staged uploads are never referenced, abandoned ones are collected once their upload url expired
+	grace := gc.cfg.GracePeriod
+	if grace < StagingUploadExpires {
+		grace = StagingUploadExpires
+	}
+	return gc.collect(stagingPrefix(gc.namespace), referenced, grace)
+}
+
+func (gc *CodeCollector) collect(prefix string, referenced map[string]struct{}, grace time.Duration) error {
+	mc := env.GlobalMinioClient()
+	doneC := make(chan struct{})
+	defer close(doneC)
+	var orphaned, removed int
+	for obj := range mc.ListObjectsV2(env.GlobalBucket, prefix, true, doneC) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		body := fmt.Sprintf("s3://%s/%s", env.GlobalBucket, obj.Key)
+		if _, ok := referenced[env.GlobalBucket+"/"+obj.Key]; ok {
+			continue
+		}
+		if time.Since(obj.LastModified) < grace {
+			continue
+		}
+		orphaned++
+		if gc.cfg.DryRun {
+			klog.Infof("(codegc) dry-run orphaned %s, size %d, last modified %s", body, obj.Size, obj.LastModified.Format(time.RFC3339))
+			continue
+		}
+		if err := mc.RemoveObject(env.GlobalBucket, obj.Key); err != nil {
+			klog.Errorf("(codegc) remove %s error %v", body, err)
+			continue
+		}
+		removed++
+		klog.Infof("(codegc) removed orphaned %s", body)
+	}
+	klog.V(1).Infof("(codegc) found %d orphaned objects under %s, removed %d", orphaned, prefix, removed)
+	return nil
+}
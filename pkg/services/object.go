@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/refunc/refunc/pkg/env"
+)
+
+const (
+	// presignExpires is lifetime of internal presigned requests used to reach versioned objects
+	presignExpires = 5 * time.Minute
+	// codeLocationExpires is lifetime of code download url returned to clients, same as aws
+	codeLocationExpires = 10 * time.Minute
+)
+
+// objectClient reads objects by presigned url, the timeout bounds reading a whole code package
+var objectClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	Timeout: 15 * time.Minute,
+}
+
+// PublicEndpoint is the minio endpoint reachable by clients, code download and upload urls are presigned for it.
+// The in-cluster endpoint is used if it's empty.
+var PublicEndpoint string
+
+var (
+	publicClientMu sync.Mutex
+	publicClient   *minio.Client
+)
+
+// publicMinioClient returns a client of PublicEndpoint for presigning, the region of bucket is looked up
+// through the in-cluster endpoint since presigning never reaches the server
+func publicMinioClient() (*minio.Client, error) {
+	if PublicEndpoint == "" {
+		return env.GlobalMinioClient(), nil
+	}
+	publicClientMu.Lock()
+	defer publicClientMu.Unlock()
+	if publicClient != nil {
+		return publicClient, nil
+	}
+	region, err := env.GlobalMinioClient().GetBucketLocation(env.GlobalBucket)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, isSecure := env.ParseMinioEndpoint(PublicEndpoint)
+	mc, err := minio.NewWithRegion(endpoint, env.GlobalAccessKey, env.GlobalSecretKey, isSecure, region)
+	if err != nil {
+		return nil, err
+	}
+	publicClient = mc
+	return mc, nil
+}
+
+// CodeLocation returns a presigned download url of function code body and its repository type
+func CodeLocation(body string) (string, string, error) {
+	if !strings.HasPrefix(body, "s3://") && !strings.HasPrefix(body, "minio://") {
+		return body, "", nil
+	}
+	u, err := url.Parse(body)
+	if err != nil {
+		return "", "", err
+	}
+	mc, err := publicMinioClient()
+	if err != nil {
+		return "", "", err
+	}
+	location, err := mc.PresignedGetObject(u.Host, strings.TrimLeft(u.Path, "/"), codeLocationExpires, url.Values{})
+	if err != nil {
+		return "", "", err
+	}
+	return location.String(), "S3", nil
+}
+
+// openS3Object opens bucket/key for reading, a non-empty etag requires object still matches it
+func openS3Object(bucket, key, version, etag string) (io.ReadCloser, int64, string, error) {
+	mc := env.GlobalMinioClient()
+	if version == "" {
+		opts := minio.GetObjectOptions{}
+		if etag != "" {
+			if err := opts.SetMatchETag(etag); err != nil {
+				return nil, 0, "", err
+			}
+		}
+		obj, err := mc.GetObject(bucket, key, opts)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		stat, err := obj.Stat()
+		if err != nil {
+			obj.Close()
+			return nil, 0, "", err
+		}
+		return obj, stat.Size, stat.ETag, nil
+	}
+	u, err := mc.PresignedGetObject(bucket, key, presignExpires, url.Values{"versionId": []string{version}})
+	if err != nil {
+		return nil, 0, "", err
+	}
+	res, err := objectClient.Get(u.String())
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, 0, "", fmt.Errorf("get s3://%s/%s?versionId=%s status %s", bucket, key, version, res.Status)
+	}
+	return res.Body, res.ContentLength, strings.Trim(res.Header.Get("ETag"), `"`), nil
+}
@@ -1,72 +1,276 @@
 package services
 
 import (
-	"bytes"
+	"archive/zip"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"strings"
 
 	"github.com/minio/minio-go"
 	"github.com/refunc/refunc/pkg/env"
+	"k8s.io/klog/v2"
 )
 
-func SetFunctionCode(code map[string]string, ns string, name string) (string, int64, string, error) {
+const (
+	MaxZipFileSize  = 50 * 1024 * 1024  // 50MB, direct upload limit
+	MaxUnzippedSize = 250 * 1024 * 1024 // 250MB, deployment package limit
+)
+
+// CopyS3Code copies S3Bucket/S3Key code sources into managed bucket instead of referencing them
+var CopyS3Code bool
+
+// code source errors, match them with errors.Is
+var (
+	ErrInvalidCode         = errors.New("invalid function code")
+	ErrInvalidZipFile      = errors.New("invalid zip file")
+	ErrRequestTooLarge     = errors.New("request too large")
+	ErrCodeStorageExceeded = errors.New("code storage exceeded")
+	ErrCodeAccessDenied    = errors.New("code source is not accessible")
+)
+
+// FunctionCode describes a stored function code
+type FunctionCode struct {
+	// storage path of code, empty if code is only checked
+	Body string
+	// size of zip in bytes
+	Size int64
+	// hex sha256 of zip, label safe hash for funcdef
+	Hash string
+	// base64 sha256 of zip, the aws way
+	CodeSha256 string
+}
+
+// CheckFunctionCode validates code source of function in ns without uploading, zip is the spooled ZipFile if any
+func CheckFunctionCode(code map[string]string, zip *ZipFile, ns string) (FunctionCode, error) {
+	bucket, bucket_ok := code["S3Bucket"]
+	key, key_ok := code["S3Key"]
+	if bucket_ok && key_ok {
+		if err := checkCodeScope(bucket, key, ns); err != nil {
+			return FunctionCode{}, err
+		}
+		code, _, err := checkFunctionS3BucketCode(bucket, key, code["S3ObjectVersion"])
+		return code, err
+	}
+	if zip != nil {
+		return zip.Finish()
+	}
+	return FunctionCode{}, fmt.Errorf("%w: function code type error", ErrInvalidCode)
+}
+
+// SetFunctionCode stores code source for function ns/name, zip is the spooled ZipFile if any
+func SetFunctionCode(code map[string]string, zip *ZipFile, ns string, name string) (FunctionCode, error) {
+	S3KeyPrefix := fmt.Sprintf("%s/funcs/%s/%s", env.GlobalScopeRoot, ns, name)
 	bucket, bucket_ok := code["S3Bucket"]
 	key, key_ok := code["S3Key"]
 	if bucket_ok && key_ok {
+		// code of gateway bucket is presigned for GetFunction, code of other namespaces is never referenced
+		if err := checkCodeScope(bucket, key, ns); err != nil {
+			return FunctionCode{}, err
+		}
+		version := code["S3ObjectVersion"]
+		// staged uploads are moved into managed prefix, they are consumed once
+		if isStagingKey(bucket, strings.TrimLeft(key, "/")) {
+			fnCode, err := copyFunctionS3BucketCode(S3KeyPrefix, ns, bucket, key, version)
+			if err != nil {
+				return fnCode, err
+			}
+			if err := env.GlobalMinioClient().RemoveObject(bucket, key); err != nil {
+				klog.Errorf("remove staged code s3://%s/%s error %v", bucket, key, err)
+			}
+			return fnCode, nil
+		}
+		// runtime loads body by bucket/key only, so a versioned object must be copied to pin it
+		if CopyS3Code || version != "" {
+			return copyFunctionS3BucketCode(S3KeyPrefix, ns, bucket, key, version)
+		}
 		return setFunctionS3BucketCode(bucket, key)
 	}
-	blob, ok := code["ZipFile"]
-	if ok {
-		S3KeyPrefix := fmt.Sprintf("%s/funcs/%s/%s", env.GlobalScopeRoot, ns, name)
-		return setFunctionBlobCode(S3KeyPrefix, blob)
+	if zip != nil {
+		return setFunctionZipCode(S3KeyPrefix, zip)
 	}
-	return "", 0, "", errors.New("function code type error")
+	return FunctionCode{}, fmt.Errorf("%w: function code type error", ErrInvalidCode)
 }
 
-func setFunctionS3BucketCode(bucket string, key string) (string, int64, string, error) {
+// checkFunctionS3BucketCode hashes and validates bucket/key, returns the etag it read
+func checkFunctionS3BucketCode(bucket, key, version string) (FunctionCode, string, error) {
+	obj, size, etag, err := openS3Object(bucket, key, version, "")
+	if err != nil {
+		return FunctionCode{}, "", fmt.Errorf("%w: get s3://%s/%s error %v", ErrInvalidCode, bucket, key, err)
+	}
+	defer obj.Close()
+	if size > MaxUnzippedSize {
+		return FunctionCode{}, "", fmt.Errorf("%w: code size %d exceeds %d", ErrCodeStorageExceeded, size, MaxUnzippedSize)
+	}
+	code, err := hashCode(obj, size)
+	if err != nil {
+		return FunctionCode{}, "", err
+	}
+	if ra, ok := obj.(io.ReaderAt); ok {
+		return code, etag, validateZip(ra, size)
+	}
+	// versioned objects are not seekable, validate them after copying
+	return code, etag, nil
+}
+
+func setFunctionS3BucketCode(bucket string, key string) (FunctionCode, error) {
+	code, _, err := checkFunctionS3BucketCode(bucket, key, "")
+	if err != nil {
+		return FunctionCode{}, err
+	}
+	code.Body = fmt.Sprintf("s3://%s/%s", bucket, key)
+	return code, nil
+}
+
+// copyFunctionS3BucketCode copies object into managed bucket, content-addressed the same as ZipFile uploads,
+// objects of gateway bucket outside ns are never copied, the copy is made with gateway credentials
+func copyFunctionS3BucketCode(S3KeyPrefix, ns, bucket, key, version string) (FunctionCode, error) {
+	if err := checkCodeScope(bucket, key, ns); err != nil {
+		return FunctionCode{}, err
+	}
 	mc := env.GlobalMinioClient()
-	stat, err := mc.StatObject(bucket, key, minio.StatObjectOptions{})
+
+	// first pass, hash the object
+	code, etag, err := checkFunctionS3BucketCode(bucket, key, version)
+	if err != nil {
+		return FunctionCode{}, err
+	}
+
+	// second pass, stream the same object into managed bucket
+	obj, _, _, err := openS3Object(bucket, key, version, etag)
+	if err != nil {
+		return FunctionCode{}, err
+	}
+	defer obj.Close()
+	managedKey := fmt.Sprintf("%s/%s.zip", S3KeyPrefix, code.Hash)
+	putSize, err := mc.PutObject(env.GlobalBucket, managedKey, obj, code.Size, minio.PutObjectOptions{})
+	if err != nil {
+		return FunctionCode{}, err
+	}
+	if putSize != code.Size {
+		return FunctionCode{}, errors.New("copy code object error")
+	}
+	code.Body = fmt.Sprintf("s3://%s/%s", env.GlobalBucket, strings.TrimPrefix(managedKey, "/"))
+
+	// validate the copy, which is seekable
+	copied, err := mc.GetObject(env.GlobalBucket, managedKey, minio.GetObjectOptions{})
 	if err != nil {
-		return "", 0, "", err
+		return FunctionCode{}, err
+	}
+	defer copied.Close()
+	if err := validateZip(copied, code.Size); err != nil {
+		if rmErr := mc.RemoveObject(env.GlobalBucket, managedKey); rmErr != nil {
+			klog.Errorf("remove invalid code %s error %v", code.Body, rmErr)
+		}
+		return FunctionCode{}, err
+	}
+	return code, nil
+}
+
+// codeKeyPrefixes are key prefixes of gateway bucket a function in ns may take code from,
+// managed code and s3 proxy objects of ns, and staged uploads of ns
+func codeKeyPrefixes(ns string) []string {
+	return []string{
+		strings.TrimPrefix(fmt.Sprintf("%s/funcs/%s/", env.GlobalScopeRoot, ns), "/"),
+		strings.TrimPrefix(fmt.Sprintf("%s/s3/%s/", env.GlobalScopeRoot, ns), "/"),
+		stagingPrefix(ns),
 	}
-	return fmt.Sprintf("s3://%s/%s", bucket, key), stat.Size, stat.ETag, nil
 }
 
-func setFunctionBlobCode(S3KeyPrefix, blob string) (string, int64, string, error) {
+// checkCodeScope denies code sources of gateway bucket outside ns, other buckets are left to minio
+func checkCodeScope(bucket, key, ns string) error {
+	if bucket != env.GlobalBucket {
+		return nil
+	}
+	key = strings.TrimLeft(key, "/")
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("%w: invalid key %s", ErrCodeAccessDenied, key)
+		}
+	}
+	for _, prefix := range codeKeyPrefixes(ns) {
+		if strings.HasPrefix(key, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: s3://%s/%s is outside namespace %s", ErrCodeAccessDenied, bucket, key, ns)
+}
+
+func setFunctionZipCode(S3KeyPrefix string, zip *ZipFile) (FunctionCode, error) {
 	mc := env.GlobalMinioClient()
-	//TODO should big size blob in memory?
-	bts, err := base64.StdEncoding.DecodeString(blob)
+	code, err := zip.Finish()
 	if err != nil {
-		return "", 0, "", err
+		return FunctionCode{}, err
 	}
-	sha256sum := sha256.Sum256(bts)
-	etag := hex.EncodeToString(sha256sum[:])
-	size := int64(len(bts))
-	key := fmt.Sprintf("%s/%s.zip", S3KeyPrefix, etag)
-	putSize, err := mc.PutObject(env.GlobalBucket, key, bytes.NewReader(bts), size, minio.PutObjectOptions{})
+	key := fmt.Sprintf("%s/%s.zip", S3KeyPrefix, code.Hash)
+	putSize, err := mc.PutObject(env.GlobalBucket, key, zip.file, code.Size, minio.PutObjectOptions{})
 	if err != nil {
-		return "", 0, "", err
+		return FunctionCode{}, err
 	}
-	if putSize != size {
-		return "", 0, "", errors.New("put code blob error")
+	if putSize != code.Size {
+		return FunctionCode{}, errors.New("put code zip error")
 	}
-	return fmt.Sprintf("s3://%s/%s", env.GlobalBucket, strings.TrimPrefix(key, "/")), size, etag, nil
+	code.Body = fmt.Sprintf("s3://%s/%s", env.GlobalBucket, strings.TrimPrefix(key, "/"))
+	return code, nil
 }
 
-func DelFunctionCode(body string) error {
-	if strings.HasPrefix(body, "s3://") || strings.HasPrefix(body, "minio://") {
-		mc := env.GlobalMinioClient()
-		u, err := url.Parse(body)
-		if err != nil {
-			return err
+func hashCode(r io.Reader, size int64) (FunctionCode, error) {
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return FunctionCode{}, err
+	}
+	if n != size {
+		return FunctionCode{}, fmt.Errorf("read code %d bytes, want %d", n, size)
+	}
+	sha256sum := hasher.Sum(nil)
+	return FunctionCode{
+		Size:       size,
+		Hash:       hex.EncodeToString(sha256sum),
+		CodeSha256: base64.StdEncoding.EncodeToString(sha256sum),
+	}, nil
+}
+
+// validateZip checks the archive is readable and its unzipped size is under limit
+func validateZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidZipFile, err)
+	}
+	var unzipped uint64
+	for _, f := range zr.File {
+		unzipped += f.UncompressedSize64
+		if unzipped > MaxUnzippedSize {
+			return fmt.Errorf("%w: unzipped size must be smaller than %d bytes", ErrCodeStorageExceeded, MaxUnzippedSize)
 		}
-		bucket := u.Host
-		return mc.RemoveObject(bucket, strings.TrimLeft(u.Path, "/"))
 	}
-	return fmt.Errorf("not support body %s", body)
+	return nil
+}
+
+// parseCodeBody parses bucket and key of a s3:// or minio:// funcdef body
+func parseCodeBody(body string) (bucket, key string, err error) {
+	if !strings.HasPrefix(body, "s3://") && !strings.HasPrefix(body, "minio://") {
+		return "", "", fmt.Errorf("not support body %s", body)
+	}
+	u, err := url.Parse(body)
+	if err != nil {
+		return "", "", err
+	}
+	return u.Host, strings.TrimLeft(u.Path, "/"), nil
+}
+
+func DelFunctionCode(body string) error {
+	bucket, key, err := parseCodeBody(body)
+	if err != nil {
+		return err
+	}
+	if bucket != env.GlobalBucket || !strings.HasPrefix(key, strings.TrimPrefix(env.GlobalScopeRoot+"/funcs/", "/")) {
+		// objects outside managed prefix belong to users
+		return nil
+	}
+	return env.GlobalMinioClient().RemoveObject(bucket, key)
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/refunc/refunc/pkg/env"
+)
+
+// StagingUploadExpires is lifetime of presigned code upload url
+const StagingUploadExpires = 15 * time.Minute
+
+// ErrStagingAccessDenied indicates a staged code key belongs to another caller
+var ErrStagingAccessDenied = errors.New("staged code belongs to another caller")
+
+// StagingUpload is a presigned PUT for a staged code package
+type StagingUpload struct {
+	Bucket     string
+	Key        string
+	URL        string
+	Expiration time.Time
+}
+
+// stagingPrefix is key prefix of staged code in ns, empty ns means all namespaces
+func stagingPrefix(ns string) string {
+	prefix := strings.TrimPrefix(fmt.Sprintf("%s/staging/", env.GlobalScopeRoot), "/")
+	if ns != "" {
+		prefix = prefix + ns + "/"
+	}
+	return prefix
+}
+
+// NewStagingUpload presigns a PUT url of a fresh staging key owned by caller in ns
+func NewStagingUpload(ns, owner string) (StagingUpload, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return StagingUpload{}, err
+	}
+	key := fmt.Sprintf("%s%s/%s.zip", stagingPrefix(ns), owner, hex.EncodeToString(id))
+	mc, err := publicMinioClient()
+	if err != nil {
+		return StagingUpload{}, err
+	}
+	u, err := mc.PresignedPutObject(env.GlobalBucket, key, StagingUploadExpires)
+	if err != nil {
+		return StagingUpload{}, err
+	}
+	return StagingUpload{
+		Bucket:     env.GlobalBucket,
+		Key:        key,
+		URL:        u.String(),
+		Expiration: time.Now().Add(StagingUploadExpires),
+	}, nil
+}
+
+// isStagingKey reports if bucket/key is in staging area of any namespace
+func isStagingKey(bucket, key string) bool {
+	return bucket == env.GlobalBucket && strings.HasPrefix(key, stagingPrefix(""))
+}
+
+// CheckStagingOwner checks the S3Bucket/S3Key code source, if staged, is owned by caller in ns
+func CheckStagingOwner(code map[string]string, ns, owner string) error {
+	bucket, key := code["S3Bucket"], strings.TrimLeft(code["S3Key"], "/")
+	if !isStagingKey(bucket, key) {
+		return nil
+	}
+	if owner == "" || !strings.HasPrefix(key, stagingPrefix(ns)+owner+"/") {
+		return ErrStagingAccessDenied
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// ZipFile decodes a base64 ZipFile written into it, spooling the zip to a temp file while hashing,
+// so big code packages are never held in memory.
+type ZipFile struct {
+	file    *os.File
+	hasher  hash.Hash
+	pending []byte
+	buf     []byte
+	size    int64
+}
+
+// NewZipFile creates a ZipFile backed by a temp file, Close removes the file
+func NewZipFile() (*ZipFile, error) {
+	file, err := os.CreateTemp("", "aws-api-gw-zip-*")
+	if err != nil {
+		return nil, err
+	}
+	return &ZipFile{
+		file:   file,
+		hasher: sha256.New(),
+	}, nil
+}
+
+// Write decodes base64 text p, line breaks are ignored
+func (z *ZipFile) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\r' || b == '\n' {
+			continue
+		}
+		z.pending = append(z.pending, b)
+	}
+	// decode complete quantums only
+	n := len(z.pending) / 4 * 4
+	if n == 0 {
+		return len(p), nil
+	}
+	if err := z.decode(z.pending[:n]); err != nil {
+		return 0, err
+	}
+	z.pending = append(z.pending[:0], z.pending[n:]...)
+	return len(p), nil
+}
+
+func (z *ZipFile) decode(src []byte) error {
+	if cap(z.buf) < base64.StdEncoding.DecodedLen(len(src)) {
+		z.buf = make([]byte, base64.StdEncoding.DecodedLen(len(src)))
+	}
+	n, err := base64.StdEncoding.Decode(z.buf[:cap(z.buf)], src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidZipFile, err)
+	}
+	z.size += int64(n)
+	if z.size > MaxZipFileSize {
+		return fmt.Errorf("%w: zip file exceeds %d bytes", ErrRequestTooLarge, MaxZipFileSize)
+	}
+	z.hasher.Write(z.buf[:n])
+	_, err = z.file.Write(z.buf[:n])
+	return err
+}
+
+// Finish flushes pending text and validates the zip, the file is rewound for reading
+func (z *ZipFile) Finish() (FunctionCode, error) {
+	if len(z.pending) > 0 {
+		return FunctionCode{}, fmt.Errorf("%w: truncated base64 text", ErrInvalidZipFile)
+	}
+	if err := validateZip(z.file, z.size); err != nil {
+		return FunctionCode{}, err
+	}
+	if _, err := z.file.Seek(0, io.SeekStart); err != nil {
+		return FunctionCode{}, err
+	}
+	sha256sum := z.hasher.Sum(nil)
+	return FunctionCode{
+		Size:       z.size,
+		Hash:       hex.EncodeToString(sha256sum),
+		CodeSha256: base64.StdEncoding.EncodeToString(sha256sum),
+	}, nil
+}
+
+// Close removes the temp file
+func (z *ZipFile) Close() error {
+	z.file.Close()
+	return os.Remove(z.file.Name())
+}
@@ -0,0 +1,112 @@
+package awsutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FunctionName is a parsed lambda function name, region, account and qualifier are empty if not given
+type FunctionName struct {
+	Region    string
+	Account   string
+	Name      string
+	Qualifier string
+}
+
+var qualifierPattern = regexp.MustCompile(`^(\$LATEST|[a-zA-Z0-9\-_]+)$`)
+
+// ParseFunctionName parses the function name forms aws accepts:
+// name, name:qualifier, account:function:name[:qualifier] and arn:partition:lambda:region:account:function:name[:qualifier]
+func ParseFunctionName(s string) (FunctionName, error) {
+	var fn FunctionName
+	parts := strings.Split(s, ":")
+	switch {
+	case len(parts) >= 7 && parts[0] == "arn":
+		if parts[2] != "lambda" || parts[5] != "function" || len(parts) > 8 {
+			return fn, fmt.Errorf("invalid function arn %q", s)
+		}
+		fn.Region, fn.Account, fn.Name = parts[3], parts[4], parts[6]
+		if len(parts) == 8 {
+			fn.Qualifier = parts[7]
+		}
+	case len(parts) >= 3 && parts[1] == "function":
+		if len(parts) > 4 {
+			return fn, fmt.Errorf("invalid partial function arn %q", s)
+		}
+		fn.Account, fn.Name = parts[0], parts[2]
+		if len(parts) == 4 {
+			fn.Qualifier = parts[3]
+		}
+	case len(parts) <= 2:
+		fn.Name = parts[0]
+		if len(parts) == 2 {
+			fn.Qualifier = parts[1]
+		}
+	default:
+		return fn, fmt.Errorf("invalid function name %q", s)
+	}
+	if fn.Name == "" {
+		return fn, fmt.Errorf("empty function name in %q", s)
+	}
+	if len(parts) > 1 && fn.Qualifier != "" && !qualifierPattern.MatchString(fn.Qualifier) {
+		return fn, fmt.Errorf("invalid qualifier %q", fn.Qualifier)
+	}
+	return fn, nil
+}
+
+// FunctionArn formats arn of function, qualifier is omitted if empty
+func FunctionArn(region, account, name, qualifier string) string {
+	arn := fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", region, account, name)
+	if qualifier != "" {
+		arn += ":" + qualifier
+	}
+	return arn
+}
+
+// EventSourceMappingArn formats arn of event source mapping
+func EventSourceMappingArn(region, account, uuid string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:event-source-mapping:%s", region, account, uuid)
+}
+
+// UserArn formats arn of an iam user, service accounts are users of their namespace
+func UserArn(account, name string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:user/%s", account, name)
+}
+
+// AssumedRoleArn formats arn of an assumed role session
+func AssumedRoleArn(account, role, sessionName string) string {
+	return fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", account, role, sessionName)
+}
+
+// EventSourceArn formats arn of a refunc event source, sourceType is the trigger type, e.g. cron
+func EventSourceArn(region, account, sourceType, name string) string {
+	return fmt.Sprintf("arn:aws:refunc:%s:%s:%s/%s", region, account, sourceType, name)
+}
+
+// ParseEventSourceArn parses arn:partition:refunc:region:account:type[/name] and the short form arn:type[:name],
+// name is empty if not given
+func ParseEventSourceArn(s string) (sourceType, name string, err error) {
+	parts := strings.Split(s, ":")
+	switch {
+	case len(parts) == 6 && parts[0] == "arn":
+		if parts[2] != "refunc" {
+			return "", "", fmt.Errorf("invalid event source arn %q", s)
+		}
+		sourceType = parts[5]
+		if i := strings.Index(sourceType, "/"); i >= 0 {
+			sourceType, name = sourceType[:i], sourceType[i+1:]
+		}
+	case (len(parts) == 2 || len(parts) == 3) && parts[0] == "arn":
+		sourceType = parts[1]
+		if len(parts) == 3 {
+			name = parts[2]
+		}
+	default:
+		return "", "", fmt.Errorf("invalid event source arn %q", s)
+	}
+	if sourceType == "" {
+		return "", "", fmt.Errorf("empty event source type in %q", s)
+	}
+	return sourceType, name, nil
+}
@@ -1,21 +1,64 @@
 package awsutils
 
 import (
-	"net/http"
+	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"github.com/refunc/aws-api-gw/pkg/utils"
 )
 
-func AWSErrorResponse(c *gin.Context, code int, msg string) {
-	theType := "User"
-	if code >= 500 {
-		theType = "Server"
+// AWSError is an exception of aws api, with the http status it's answered with
+type AWSError struct {
+	Status    int
+	Exception string
+	Message   string
+}
+
+func (e AWSError) Error() string {
+	return e.Exception + ": " + e.Message
+}
+
+// WithMessage returns a copy of e with a descriptive message
+func (e AWSError) WithMessage(format string, a ...interface{}) AWSError {
+	e.Message = fmt.Sprintf(format, a...)
+	return e
+}
+
+// lambda exceptions, see https://docs.aws.amazon.com/lambda/latest/api/CommonErrors.html
+var (
+	ErrServiceException = AWSError{500, "ServiceException", "The service encountered an internal error."}
+
+	ErrInvalidParameterValue = AWSError{400, "InvalidParameterValueException", "One of the parameters in the request is not valid."}
+	ErrInvalidRequestContent = AWSError{400, "InvalidRequestContentException", "The request body could not be parsed as JSON."}
+	ErrCodeStorageExceeded   = AWSError{400, "CodeStorageExceededException", "Your code size exceeds the maximum."}
+	ErrAccessDenied          = AWSError{403, "AccessDeniedException", "You do not have sufficient access to perform this action."}
+	ErrResourceNotFound      = AWSError{404, "ResourceNotFoundException", "The resource specified in the request does not exist."}
+	ErrResourceConflict      = AWSError{409, "ResourceConflictException", "The resource already exists, or another operation is in progress."}
+	ErrPreconditionFailed    = AWSError{412, "PreconditionFailedException", "The RevisionId provided does not match the latest RevisionId of the resource."}
+	ErrRequestTooLarge       = AWSError{413, "RequestTooLargeException", "The request payload exceeded the quota."}
+	ErrTooManyRequests       = AWSError{429, "TooManyRequestsException", "The request throughput limit was exceeded."}
+	ErrInvalidZipFile        = AWSError{502, "InvalidZipFileException", "The deployment package could not be unzipped."}
+
+	// authentication exceptions shared by aws services
+	ErrIncompleteSignature        = AWSError{400, "IncompleteSignatureException", "The request signature does not conform to AWS standards."}
+	ErrMissingAuthenticationToken = AWSError{403, "MissingAuthenticationTokenException", "The request must contain a valid access key ID or X.509 certificate."}
+	ErrUnrecognizedClient         = AWSError{403, "UnrecognizedClientException", "The security token included in the request is invalid."}
+	ErrInvalidSignature           = AWSError{403, "InvalidSignatureException", "The request signature we calculated does not match the signature you provided."}
+	ErrExpiredToken               = AWSError{403, "ExpiredTokenException", "The security token included in the request is expired."}
+)
+
+// ErrorResponse answers err the aws rest-json way, SDKs classify and retry by status and x-amzn-ErrorType
+func ErrorResponse(c *gin.Context, err AWSError) {
+	// client errors are common, they are only logged verbosely
+	theType, log := "User", utils.Log(c).V(2)
+	if err.Status >= 500 {
+		theType, log = "Server", utils.Log(c)
 	}
-	errorType := "InternalFailure"
-	c.Header("x-amzn-errortype", errorType)
-	c.JSON(http.StatusBadRequest, gin.H{
+	log.Infof("%s %s answered %d %s", c.Request.Method, c.Request.URL.Path, err.Status, err)
+	c.Header("x-amzn-ErrorType", err.Exception)
+	c.JSON(err.Status, gin.H{
 		"Type":    theType,
-		"message": msg,
-		"__type":  errorType,
+		"Message": err.Message,
+		"__type":  err.Exception,
 	})
 }
@@ -0,0 +1,263 @@
+package awsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PolicyDocument is an iam identity policy, see https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_grammar.html
+type PolicyDocument struct {
+	Version   string
+	Statement []PolicyStatement
+}
+
+// PolicyStatement is a statement of policy, Action/NotAction and Resource/NotResource are exclusive
+type PolicyStatement struct {
+	Sid         string
+	Effect      string
+	Action      stringOrSlice
+	NotAction   stringOrSlice
+	Resource    stringOrSlice
+	NotResource stringOrSlice
+	// operator -> condition key -> values
+	Condition map[string]map[string]stringOrSlice
+}
+
+// PolicyRequest is what a policy is evaluated against, condition keys are case insensitive
+type PolicyRequest struct {
+	Action     string
+	Resource   string
+	Conditions map[string]string
+}
+
+// PolicyDecision of evaluation, implicit deny unless allowed
+type PolicyDecision int
+
+const (
+	PolicyImplicitDeny PolicyDecision = iota
+	PolicyAllow
+	PolicyExplicitDeny
+)
+
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = []string{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("expect string or list of string, got %s", data)
+	}
+	*s = many
+	return nil
+}
+
+// conditionOperators are supported operators, IfExists suffix is supported on each
+var conditionOperators = map[string]func(value, pattern string) bool{
+	"StringEquals":              func(v, p string) bool { return v == p },
+	"StringNotEquals":           func(v, p string) bool { return v != p },
+	"StringEqualsIgnoreCase":    strings.EqualFold,
+	"StringNotEqualsIgnoreCase": func(v, p string) bool { return !strings.EqualFold(v, p) },
+	"StringLike":                func(v, p string) bool { return globMatch(p, v) },
+	"StringNotLike":             func(v, p string) bool { return !globMatch(p, v) },
+	"ArnEquals":                 func(v, p string) bool { return v == p },
+	"ArnLike":                   func(v, p string) bool { return globMatch(p, v) },
+	"ArnNotEquals":              func(v, p string) bool { return v != p },
+	"ArnNotLike":                func(v, p string) bool { return !globMatch(p, v) },
+	"Bool":                      strings.EqualFold,
+	"IpAddress":                 ipMatch,
+	"NotIpAddress":              func(v, p string) bool { return !ipMatch(v, p) },
+	"DateLessThan":              func(v, p string) bool { return compareDate(v, p, func(a, b time.Time) bool { return a.Before(b) }) },
+	"DateGreaterThan":           func(v, p string) bool { return compareDate(v, p, func(a, b time.Time) bool { return a.After(b) }) },
+	"NumericEquals":             func(v, p string) bool { return compareNumber(v, p, func(a, b float64) bool { return a == b }) },
+	"NumericLessThan":           func(v, p string) bool { return compareNumber(v, p, func(a, b float64) bool { return a < b }) },
+	"NumericGreaterThan":        func(v, p string) bool { return compareNumber(v, p, func(a, b float64) bool { return a > b }) },
+}
+
+// negatedOperators match when any value is not matched, others when any value is matched
+var negatedOperators = map[string]bool{
+	"StringNotEquals":           true,
+	"StringNotEqualsIgnoreCase": true,
+	"StringNotLike":             true,
+	"ArnNotEquals":              true,
+	"ArnNotLike":                true,
+	"NotIpAddress":              true,
+}
+
+// ParsePolicyDocument parses and validates policy, a policy that can't be fully understood is an error
+func ParsePolicyDocument(data []byte) (*PolicyDocument, error) {
+	var raw struct {
+		Version   string
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	doc := &PolicyDocument{Version: raw.Version}
+	if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+		var stmt PolicyStatement
+		if err := json.Unmarshal(raw.Statement, &stmt); err != nil {
+			return nil, err
+		}
+		doc.Statement = []PolicyStatement{stmt}
+	} else if err := json.Unmarshal(raw.Statement, &doc.Statement); err != nil {
+		return nil, err
+	}
+	for i, stmt := range doc.Statement {
+		if stmt.Effect != "Allow" && stmt.Effect != "Deny" {
+			return nil, fmt.Errorf("statement %d: Effect must be Allow or Deny", i)
+		}
+		if (len(stmt.Action) == 0) == (len(stmt.NotAction) == 0) {
+			return nil, fmt.Errorf("statement %d: exactly one of Action and NotAction is required", i)
+		}
+		if (len(stmt.Resource) == 0) == (len(stmt.NotResource) == 0) {
+			return nil, fmt.Errorf("statement %d: exactly one of Resource and NotResource is required", i)
+		}
+		for op := range stmt.Condition {
+			if _, ok := conditionOperators[strings.TrimSuffix(op, "IfExists")]; !ok {
+				return nil, fmt.Errorf("statement %d: unsupported condition operator %s", i, op)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// EvaluatePolicies decides req against policies, an explicit deny in any policy overrides allows
+func EvaluatePolicies(docs []*PolicyDocument, req *PolicyRequest) PolicyDecision {
+	decision := PolicyImplicitDeny
+	for _, doc := range docs {
+		for i := range doc.Statement {
+			stmt := &doc.Statement[i]
+			if !stmt.matches(req) {
+				continue
+			}
+			if stmt.Effect == "Deny" {
+				return PolicyExplicitDeny
+			}
+			decision = PolicyAllow
+		}
+	}
+	return decision
+}
+
+func (s *PolicyStatement) matches(req *PolicyRequest) bool {
+	if len(s.Action) > 0 && !matchAny(s.Action, req.Action, true) {
+		return false
+	}
+	if len(s.NotAction) > 0 && matchAny(s.NotAction, req.Action, true) {
+		return false
+	}
+	if len(s.Resource) > 0 && !matchAny(s.Resource, req.Resource, false) {
+		return false
+	}
+	if len(s.NotResource) > 0 && matchAny(s.NotResource, req.Resource, false) {
+		return false
+	}
+	for op, conditions := range s.Condition {
+		ifExists := strings.HasSuffix(op, "IfExists")
+		op = strings.TrimSuffix(op, "IfExists")
+		match := conditionOperators[op]
+		for key, patterns := range conditions {
+			value, ok := lookupCondition(req.Conditions, key)
+			if !ok {
+				// a missing key matches nothing, which is what negated operators ask for
+				if ifExists || negatedOperators[op] {
+					continue
+				}
+				return false
+			}
+			matched := negatedOperators[op]
+			for _, p := range patterns {
+				if negatedOperators[op] {
+					matched = matched && match(value, p)
+				} else if match(value, p) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func lookupCondition(conditions map[string]string, key string) (string, bool) {
+	for k, v := range conditions {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// matchAny matches value against wildcard patterns, actions are case insensitive
+func matchAny(patterns []string, value string, ignoreCase bool) bool {
+	for _, p := range patterns {
+		if ignoreCase {
+			p, value = strings.ToLower(p), strings.ToLower(value)
+		}
+		if globMatch(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches * and ? wildcards, other characters are literal
+func globMatch(pattern, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			// backtrack, let the last * eat one more character
+			p, mark = star+1, mark+1
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func ipMatch(value, cidr string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(cidr, "/") {
+		return ip.Equal(net.ParseIP(cidr))
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	return err == nil && network.Contains(ip)
+}
+
+func compareDate(value, pattern string, cmp func(a, b time.Time) bool) bool {
+	a, err1 := time.Parse(time.RFC3339, value)
+	b, err2 := time.Parse(time.RFC3339, pattern)
+	return err1 == nil && err2 == nil && cmp(a, b)
+}
+
+func compareNumber(value, pattern string, cmp func(a, b float64) bool) bool {
+	a, err1 := strconv.ParseFloat(value, 64)
+	b, err2 := strconv.ParseFloat(pattern, 64)
+	return err1 == nil && err2 == nil && cmp(a, b)
+}
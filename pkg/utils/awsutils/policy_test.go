@@ -0,0 +1,245 @@
+package awsutils
+
+import (
+	"testing"
+)
+
+func mustParsePolicy(t *testing.T, doc string) *PolicyDocument {
+	t.Helper()
+	policy, err := ParsePolicyDocument([]byte(doc))
+	if err != nil {
+		t.Fatalf("parse policy %s error %v", doc, err)
+	}
+	return policy
+}
+
+func TestParsePolicyDocument(t *testing.T) {
+	cases := []struct {
+		name       string
+		doc        string
+		statements int
+		hasErr     bool
+	}{
+		{
+			name:       "single statement object",
+			doc:        `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"lambda:*","Resource":"*"}}`,
+			statements: 1,
+		},
+		{
+			name:       "statement list",
+			doc:        `{"Statement":[{"Effect":"Allow","Action":["lambda:GetFunction"],"Resource":"*"},{"Effect":"Deny","NotAction":"lambda:Get*","NotResource":["arn:*"]}]}`,
+			statements: 2,
+		},
+		{
+			name:       "condition with IfExists",
+			doc:        `{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEqualsIfExists":{"aws:SourceIp":"10.0.0.1"}}}}`,
+			statements: 1,
+		},
+		{name: "invalid json", doc: `{"Statement":`, hasErr: true},
+		{name: "invalid effect", doc: `{"Statement":{"Effect":"Maybe","Action":"*","Resource":"*"}}`, hasErr: true},
+		{name: "missing action", doc: `{"Statement":{"Effect":"Allow","Resource":"*"}}`, hasErr: true},
+		{name: "action and not action", doc: `{"Statement":{"Effect":"Allow","Action":"*","NotAction":"x","Resource":"*"}}`, hasErr: true},
+		{name: "missing resource", doc: `{"Statement":{"Effect":"Allow","Action":"*"}}`, hasErr: true},
+		{name: "resource and not resource", doc: `{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","NotResource":"*"}}`, hasErr: true},
+		{name: "action not a string", doc: `{"Statement":{"Effect":"Allow","Action":1,"Resource":"*"}}`, hasErr: true},
+		{name: "unsupported operator", doc: `{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"ForAnyValue:StringLike":{"k":"v"}}}}`, hasErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := ParsePolicyDocument([]byte(tc.doc))
+			if tc.hasErr {
+				if err == nil {
+					t.Fatalf("expect error, got %+v", doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(doc.Statement) != tc.statements {
+				t.Errorf("statements = %d, want %d", len(doc.Statement), tc.statements)
+			}
+		})
+	}
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	const fnArn = "arn:aws:lambda:us-east-1:123456789012:function:hello"
+	cases := []struct {
+		name     string
+		docs     []string
+		req      PolicyRequest
+		decision PolicyDecision
+	}{
+		{
+			name:     "no policy",
+			req:      PolicyRequest{Action: "lambda:InvokeFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "allow",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"lambda:InvokeFunction","Resource":"` + fnArn + `"}}`},
+			req:      PolicyRequest{Action: "lambda:InvokeFunction", Resource: fnArn},
+			decision: PolicyAllow,
+		},
+		{
+			name: "explicit deny in another policy wins",
+			docs: []string{
+				`{"Statement":{"Effect":"Allow","Action":"lambda:*","Resource":"*"}}`,
+				`{"Statement":{"Effect":"Deny","Action":"lambda:InvokeFunction","Resource":"*"}}`,
+			},
+			req:      PolicyRequest{Action: "lambda:InvokeFunction", Resource: fnArn},
+			decision: PolicyExplicitDeny,
+		},
+		{
+			name:     "explicit deny before allow in one policy",
+			docs:     []string{`{"Statement":[{"Effect":"Deny","Action":"*","Resource":"*"},{"Effect":"Allow","Action":"*","Resource":"*"}]}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyExplicitDeny,
+		},
+		{
+			name:     "wildcard action is case insensitive",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"LAMBDA:Get*","Resource":"*"}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunctionConfiguration", Resource: fnArn},
+			decision: PolicyAllow,
+		},
+		{
+			name:     "wildcard action not matched",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"lambda:Get*","Resource":"*"}}`},
+			req:      PolicyRequest{Action: "lambda:DeleteFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "wildcard resource",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"arn:aws:lambda:*:*:function:hel?o"}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyAllow,
+		},
+		{
+			name:     "resource is case sensitive",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"arn:aws:lambda:*:*:function:Hello"}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "not action",
+			docs:     []string{`{"Statement":{"Effect":"Allow","NotAction":"lambda:Delete*","Resource":"*"}}`},
+			req:      PolicyRequest{Action: "lambda:DeleteFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "not resource",
+			docs:     []string{`{"Statement":{"Effect":"Deny","Action":"*","NotResource":"arn:aws:lambda:*:*:function:hello"}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "condition matched with case insensitive key",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"IpAddress":{"aws:SourceIp":"10.0.0.0/8"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"AWS:SOURCEIP": "10.1.2.3"}},
+			decision: PolicyAllow,
+		},
+		{
+			name:     "missing condition key does not match",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEquals":{"aws:PrincipalTag/team":"a"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "missing condition key of negated operator matches",
+			docs:     []string{`{"Statement":{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"StringNotEquals":{"aws:PrincipalTag/team":"a"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyExplicitDeny,
+		},
+		{
+			name:     "missing condition key with IfExists matches",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEqualsIfExists":{"aws:PrincipalTag/team":"a"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn},
+			decision: PolicyAllow,
+		},
+		{
+			name:     "present condition key with IfExists is evaluated",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringEqualsIfExists":{"aws:PrincipalTag/team":"a"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"aws:PrincipalTag/team": "b"}},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "multi value operator matches any value",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"StringLike":{"aws:PrincipalArn":["*:user/x","*:user/y*"]}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"aws:PrincipalArn": "arn:aws:iam::1:user/yz"}},
+			decision: PolicyAllow,
+		},
+		{
+			name:     "multi value negated operator matches none of values",
+			docs:     []string{`{"Statement":{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"NotIpAddress":{"aws:SourceIp":["10.0.0.0/8","192.168.0.0/16"]}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"aws:SourceIp": "8.8.8.8"}},
+			decision: PolicyExplicitDeny,
+		},
+		{
+			name:     "multi value negated operator fails if one value matches",
+			docs:     []string{`{"Statement":{"Effect":"Deny","Action":"*","Resource":"*","Condition":{"NotIpAddress":{"aws:SourceIp":["10.0.0.0/8","192.168.0.0/16"]}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"aws:SourceIp": "192.168.1.1"}},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name: "all operators must match",
+			docs: []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{
+				"Bool":{"aws:SecureTransport":"true"},
+				"DateLessThan":{"aws:CurrentTime":"2030-01-01T00:00:00Z"},
+				"NumericLessThan":{"lambda:MemorySize":"512"}}}}`},
+			req: PolicyRequest{Action: "lambda:CreateFunction", Resource: "*", Conditions: map[string]string{
+				"aws:SecureTransport": "True",
+				"aws:CurrentTime":     "2029-12-31T23:59:59Z",
+				"lambda:MemorySize":   "1024",
+			}},
+			decision: PolicyImplicitDeny,
+		},
+		{
+			name:     "invalid condition value does not match",
+			docs:     []string{`{"Statement":{"Effect":"Allow","Action":"*","Resource":"*","Condition":{"DateGreaterThan":{"aws:CurrentTime":"2020-01-01T00:00:00Z"}}}}`},
+			req:      PolicyRequest{Action: "lambda:GetFunction", Resource: fnArn, Conditions: map[string]string{"aws:CurrentTime": "yesterday"}},
+			decision: PolicyImplicitDeny,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var docs []*PolicyDocument
+			for _, doc := range tc.docs {
+				docs = append(docs, mustParsePolicy(t, doc))
+			}
+			if decision := EvaluatePolicies(docs, &tc.req); decision != tc.decision {
+				t.Errorf("decision = %v, want %v", decision, tc.decision)
+			}
+		})
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*:function:*", "arn:aws:lambda:r:1:function:f", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "acb", false},
+		{"**", "x", true},
+		{"a.c", "abc", false},
+		{"[a]", "a", false},
+		{"abc", "abcd", false},
+	}
+	for _, tc := range cases {
+		if match := globMatch(tc.pattern, tc.value); match != tc.match {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.value, match, tc.match)
+		}
+	}
+}
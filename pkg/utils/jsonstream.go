@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const maxJSONDepth = 64
+
+// StreamJSONString scans json from r, the string value at path is streamed into the writer returned by open
+// and replaced with "" in the returned document, so a big field is never held in memory. open is called
+// only when the field is found, which is also reported.
+func StreamJSONString(r io.Reader, path []string, open func() (io.Writer, error)) ([]byte, bool, error) {
+	s := &jsonStreamer{
+		r:      bufio.NewReader(r),
+		target: path,
+		open:   open,
+	}
+	if err := s.value(nil, 0); err != nil {
+		return nil, false, err
+	}
+	if err := s.skipSpace(); err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	if _, err := s.r.ReadByte(); err != io.EOF {
+		return nil, false, errors.New("json: invalid character after top-level value")
+	}
+	return s.out.Bytes(), s.found, nil
+}
+
+type jsonStreamer struct {
+	r      *bufio.Reader
+	out    bytes.Buffer
+	target []string
+	open   func() (io.Writer, error)
+	found  bool
+}
+
+func (s *jsonStreamer) skipSpace() error {
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return s.r.UnreadByte()
+		}
+		s.out.WriteByte(b)
+	}
+}
+
+func (s *jsonStreamer) peek() (byte, error) {
+	if err := s.skipSpace(); err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	bts, err := s.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return bts[0], nil
+}
+
+func (s *jsonStreamer) expect(c byte) error {
+	b, err := s.peek()
+	if err != nil {
+		return err
+	}
+	if b != c {
+		return fmt.Errorf("json: expect %q got %q", c, b)
+	}
+	s.r.ReadByte()
+	s.out.WriteByte(b)
+	return nil
+}
+
+func (s *jsonStreamer) isTarget(path []string) bool {
+	if s.found || len(path) != len(s.target) {
+		return false
+	}
+	for i := range path {
+		if path[i] != s.target[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jsonStreamer) value(path []string, depth int) error {
+	if depth > maxJSONDepth {
+		return errors.New("json: exceeded max depth")
+	}
+	b, err := s.peek()
+	if err != nil {
+		return err
+	}
+	switch {
+	case b == '{':
+		return s.object(path, depth)
+	case b == '[':
+		return s.array(path, depth)
+	case b == '"':
+		if s.isTarget(path) {
+			s.found = true
+			s.out.WriteString(`""`)
+			w, err := s.open()
+			if err != nil {
+				return err
+			}
+			return s.streamString(w)
+		}
+		_, err := s.copyString()
+		return err
+	default:
+		return s.literal()
+	}
+}
+
+func (s *jsonStreamer) object(path []string, depth int) error {
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	b, err := s.peek()
+	if err != nil {
+		return err
+	}
+	if b == '}' {
+		return s.expect('}')
+	}
+	for {
+		if b, err = s.peek(); err != nil {
+			return err
+		}
+		if b != '"' {
+			return fmt.Errorf("json: expect object key got %q", b)
+		}
+		key, err := s.copyString()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(key, `\`) {
+			// match escaped keys by what they decode to
+			if err := json.Unmarshal([]byte(`"`+key+`"`), &key); err != nil {
+				return err
+			}
+		}
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+		if err := s.value(append(path[:len(path):len(path)], key), depth+1); err != nil {
+			return err
+		}
+		if b, err = s.peek(); err != nil {
+			return err
+		}
+		if b == '}' {
+			return s.expect('}')
+		}
+		if err := s.expect(','); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *jsonStreamer) array(path []string, depth int) error {
+	if err := s.expect('['); err != nil {
+		return err
+	}
+	b, err := s.peek()
+	if err != nil {
+		return err
+	}
+	if b == ']' {
+		return s.expect(']')
+	}
+	for {
+		// array items never match a target path
+		if err := s.value(append(path[:len(path):len(path)], "[]"), depth+1); err != nil {
+			return err
+		}
+		if b, err = s.peek(); err != nil {
+			return err
+		}
+		if b == ']' {
+			return s.expect(']')
+		}
+		if err := s.expect(','); err != nil {
+			return err
+		}
+	}
+}
+
+// literal copies a number, true, false or null into out
+func (s *jsonStreamer) literal() error {
+	var lit bytes.Buffer
+	for {
+		b, err := s.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if b == ',' || b == '}' || b == ']' || b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			if err := s.r.UnreadByte(); err != nil {
+				return err
+			}
+			break
+		}
+		lit.WriteByte(b)
+	}
+	// strings, objects and arrays never get here, what json accepts is a valid literal
+	if !json.Valid(lit.Bytes()) {
+		return fmt.Errorf("json: invalid literal %q", lit.Bytes())
+	}
+	s.out.Write(lit.Bytes())
+	return nil
+}
+
+// copyString copies a quoted string into out, returns its raw content
+func (s *jsonStreamer) copyString() (string, error) {
+	if err := s.expect('"'); err != nil {
+		return "", err
+	}
+	var raw bytes.Buffer
+	escaped := false
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		s.out.WriteByte(b)
+		if !escaped && b == '"' {
+			return raw.String(), nil
+		}
+		raw.WriteByte(b)
+		escaped = !escaped && b == '\\'
+	}
+}
+
+// streamString writes content of a quoted string into w, only escapes which may appear in base64 text are supported
+func (s *jsonStreamer) streamString(w io.Writer) error {
+	if _, err := s.r.ReadByte(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if b == '"' {
+			return bw.Flush()
+		}
+		if b != '\\' {
+			if err := bw.WriteByte(b); err != nil {
+				return err
+			}
+			continue
+		}
+		esc, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch esc {
+		case '/':
+			err = bw.WriteByte('/')
+		case 'n', 'r', 't':
+			// line breaks of wrapped base64 text
+		case 'u':
+			var hexBts [4]byte
+			if _, err = io.ReadFull(s.r, hexBts[:]); err != nil {
+				return err
+			}
+			var ch [2]byte
+			if _, err = hex.Decode(ch[:], hexBts[:]); err != nil {
+				return err
+			}
+			if ch[0] != 0 || ch[1] >= 0x80 {
+				return fmt.Errorf("json: unsupported escape \\u%s", hexBts)
+			}
+			err = bw.WriteByte(ch[1])
+		default:
+			return fmt.Errorf("json: unsupported escape \\%c", esc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
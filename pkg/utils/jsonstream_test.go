@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamJSONString(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		path   []string
+		doc    string
+		field  string
+		found  bool
+		hasErr bool
+	}{
+		{
+			name:  "field first",
+			input: `{"ZipFile":"UEsDBA==","Publish":true}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"ZipFile":"","Publish":true}`,
+			field: "UEsDBA==",
+			found: true,
+		},
+		{
+			name:  "field last",
+			input: `{"Publish": false, "RevisionId": null, "ZipFile": "UEsDBA=="}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"Publish": false, "RevisionId": null, "ZipFile": ""}`,
+			field: "UEsDBA==",
+			found: true,
+		},
+		{
+			name:  "nested field",
+			input: `{"FunctionName":"f","Code":{"S3Bucket":"","ZipFile":"UEsD\nBA=="},"MemorySize":128}`,
+			path:  []string{"Code", "ZipFile"},
+			doc:   `{"FunctionName":"f","Code":{"S3Bucket":"","ZipFile":""},"MemorySize":128}`,
+			field: "UEsDBA==",
+			found: true,
+		},
+		{
+			name:  "same key elsewhere",
+			input: `{"ZipFile":"x","Tags":{"Code":{"ZipFile":"y"}},"Layers":[{"ZipFile":"z"}]}`,
+			path:  []string{"Code", "ZipFile"},
+			doc:   `{"ZipFile":"x","Tags":{"Code":{"ZipFile":"y"}},"Layers":[{"ZipFile":"z"}]}`,
+		},
+		{
+			name:  "missing field",
+			input: `{"S3Bucket":"b","S3Key":"k"}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"S3Bucket":"b","S3Key":"k"}`,
+		},
+		{
+			name:  "escapes in field",
+			input: `{"ZipFile":"UEsD\/BA==\r\n"}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"ZipFile":""}`,
+			field: "UEsD/BA==",
+			found: true,
+		},
+		{
+			name:  "escapes in other strings",
+			input: `{"Description":"say \"hi\" \\ é","ZipFile":"QQ=="}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"Description":"say \"hi\" \\ é","ZipFile":""}`,
+			field: "QQ==",
+			found: true,
+		},
+		{
+			name:  "escaped key",
+			input: `{"Zip\u0046ile":"QQ=="}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"Zip\u0046ile":""}`,
+			field: "QQ==",
+			found: true,
+		},
+		{
+			name:  "numbers and literals",
+			input: `{"MemorySize":-1.5e3,"Timeout":0,"Publish":true,"DryRun":false,"Layers":[null,1]}`,
+			path:  []string{"ZipFile"},
+			doc:   `{"MemorySize":-1.5e3,"Timeout":0,"Publish":true,"DryRun":false,"Layers":[null,1]}`,
+		},
+		{name: "unsupported escape in field", input: `{"ZipFile":"\u00e9"}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "truncated field", input: `{"ZipFile":"UEsD`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "truncated string", input: `{"Description":"abc`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "truncated object", input: `{"Publish":true,`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "truncated literal", input: `{"Publish":tru`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "empty input", input: ``, path: []string{"ZipFile"}, hasErr: true},
+		{name: "invalid literal", input: `{"Publish":yes}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "invalid number", input: `{"MemorySize":01}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "missing value", input: `{"Layers":[,1]}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "unquoted key", input: `{Publish:true}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "trailing data", input: `{"Publish":true} {}`, path: []string{"ZipFile"}, hasErr: true},
+		{name: "too deep", input: strings.Repeat("[", maxJSONDepth+2) + strings.Repeat("]", maxJSONDepth+2), path: []string{"ZipFile"}, hasErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var field bytes.Buffer
+			opened := false
+			doc, found, err := StreamJSONString(strings.NewReader(tc.input), tc.path, func() (io.Writer, error) {
+				opened = true
+				return &field, nil
+			})
+			if tc.hasErr {
+				if err == nil {
+					t.Fatalf("expect error, got doc %s", doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if string(doc) != tc.doc {
+				t.Errorf("doc = %s, want %s", doc, tc.doc)
+			}
+			if !json.Valid(doc) {
+				t.Errorf("doc %s is not valid json", doc)
+			}
+			if found != tc.found || opened != tc.found {
+				t.Errorf("found = %v, opened = %v, want %v", found, opened, tc.found)
+			}
+			if field.String() != tc.field {
+				t.Errorf("field = %q, want %q", field.String(), tc.field)
+			}
+		})
+	}
+}
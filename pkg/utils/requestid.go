@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog/v2"
+)
+
+// HeaderRequestID is the header request id is answered with
+const HeaderRequestID = "x-amzn-RequestId"
+
+var requestSeq uint64
+
+// NewRequestID returns a random uuid v4, or one made of time and a sequence if randomness is unavailable
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:], atomic.AddUint64(&requestSeq, 1))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// GetRequestID returns id of current request, set by request id middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("requestID")
+}
+
+// RequestLog logs lines of a request prefixed by its id, `(<request id>) ...`
+type RequestLog struct {
+	prefix  string
+	enabled bool
+}
+
+// Log returns logger of current request, it must not be used after the request is answered
+func Log(c *gin.Context) RequestLog {
+	return RequestLog{prefix: "(" + GetRequestID(c) + ") ", enabled: true}
+}
+
+// V logs only if verbosity is at least level
+func (l RequestLog) V(level klog.Level) RequestLog {
+	l.enabled = l.enabled && klog.V(level).Enabled()
+	return l
+}
+
+func (l RequestLog) Infof(format string, args ...interface{}) {
+	if l.enabled {
+		klog.InfoDepth(1, l.prefix+fmt.Sprintf(format, args...))
+	}
+}
+
+func (l RequestLog) Warningf(format string, args ...interface{}) {
+	if l.enabled {
+		klog.WarningDepth(1, l.prefix+fmt.Sprintf(format, args...))
+	}
+}
+
+func (l RequestLog) Errorf(format string, args ...interface{}) {
+	if l.enabled {
+		klog.ErrorDepth(1, l.prefix+fmt.Sprintf(format, args...))
+	}
+}
+
+func (l RequestLog) Error(args ...interface{}) {
+	if l.enabled {
+		klog.ErrorDepth(1, l.prefix+fmt.Sprint(args...))
+	}
+}
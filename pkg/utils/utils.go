@@ -9,6 +9,7 @@ import (
 	rfclientset "github.com/refunc/refunc/pkg/generated/clientset/versioned"
 	rflister "github.com/refunc/refunc/pkg/generated/listers/refunc/v1beta3"
 	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 )
 
@@ -48,3 +49,27 @@ func GetNatsConn(c *gin.Context) (*nats.Conn, error) {
 	}
 	return conn.(*nats.Conn), nil
 }
+
+func GetFuncinstLister(c *gin.Context) (rflister.FuncinstLister, error) {
+	fniLister, ok := c.Get("funcinstLister")
+	if !ok {
+		return nil, errors.New("get funcinst lister error")
+	}
+	return fniLister.(rflister.FuncinstLister), nil
+}
+
+func GetXenvLister(c *gin.Context) (rflister.XenvLister, error) {
+	xenvLister, ok := c.Get("xenvLister")
+	if !ok {
+		return nil, errors.New("get xenv lister error")
+	}
+	return xenvLister.(rflister.XenvLister), nil
+}
+
+func GetServiceAccountLister(c *gin.Context) (corev1listers.ServiceAccountLister, error) {
+	saLister, ok := c.Get("serviceAccountLister")
+	if !ok {
+		return nil, errors.New("get service account lister error")
+	}
+	return saLister.(corev1listers.ServiceAccountLister), nil
+}